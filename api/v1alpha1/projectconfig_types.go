@@ -35,8 +35,173 @@ type ProjectConfig struct {
 	cfg.ControllerManagerConfigurationSpec `json:",inline"`
 
 	// vRealize Automation Cloud API Authentication
-	URL          string `json:"url,omitempty"`
+	URL string `json:"url,omitempty"`
+
+	// RefreshToken is used when RefreshTokenSecretRef is not set, it can also
+	// be provided through the VRA_REFRESH_TOKEN environment variable.
 	RefreshToken string `json:"refreshToken,omitempty"`
+
+	// RefreshTokenSecretRef selects the Secret key holding the refresh token.
+	// The Secret is watched and the vRA client is rebuilt when it changes.
+	// +optional
+	RefreshTokenSecretRef *SecretKeyReference `json:"refreshTokenSecretRef,omitempty"`
+
+	// AuthMode selects how to log in, RefreshToken when empty
+	// +optional
+	AuthMode AuthMode `json:"authMode,omitempty"`
+
+	// Username and Domain to log in with when AuthMode is Password
+	// +optional
+	Username string `json:"username,omitempty"`
+	// +optional
+	Domain string `json:"domain,omitempty"`
+
+	// PasswordSecretRef selects the Secret key holding the password when
+	// AuthMode is Password. It is watched like RefreshTokenSecretRef.
+	// +optional
+	PasswordSecretRef *SecretKeyReference `json:"passwordSecretRef,omitempty"`
+
+	// TLS settings for the connection to vRealize Automation
+	// +optional
+	TLS *TLSConfig `json:"tls,omitempty"`
+
+	// ClusterID is tagged on every machine the controller creates and
+	// machines are only looked up among those carrying it, so that clusters
+	// sharing a vRA project leave each other's machines alone
+	// +optional
+	ClusterID string `json:"clusterID,omitempty"`
+
+	// DefaultDeletionPolicy applies to the VirtualMachines without a
+	// deletionPolicy, Delete when empty
+	// +kubebuilder:validation:Enum=Delete;Orphan;PowerOffAndRetain
+	// +optional
+	DefaultDeletionPolicy string `json:"defaultDeletionPolicy,omitempty"`
+
+	// RequestTracking configures how the vRA requests of VirtualMachines are
+	// polled and how long they may run
+	// +optional
+	RequestTracking *RequestTrackingConfig `json:"requestTracking,omitempty"`
+}
+
+// RequestTrackingConfig configures the polling of vRA requests. A running
+// request is checked after PollInterval, then after waits that double, give
+// or take some jitter, up to MaxPollInterval.
+type RequestTrackingConfig struct {
+	// PollInterval is the first wait, 20s when unset
+	// +optional
+	PollInterval *metav1.Duration `json:"pollInterval,omitempty"`
+
+	// MaxPollInterval is the longest wait, 5m when unset
+	// +optional
+	MaxPollInterval *metav1.Duration `json:"maxPollInterval,omitempty"`
+
+	// Timeouts after which a running request is reported as failed
+	// +optional
+	Timeouts *RequestTimeouts `json:"timeouts,omitempty"`
+}
+
+// RequestTimeouts are how long the requests of each operation may run, the
+// defaults of the controller apply to the ones left unset. A day-2 request
+// that times out is given up and the operation tried again. Create and delete
+// requests cannot be submitted again without risking a second machine, so
+// they are still polled once timed out, every MaxPollInterval at most. A
+// VirtualMachine deleted after its create request timed out stops waiting for
+// the request.
+type RequestTimeouts struct {
+	// Create is the timeout of machine creation, 1h when unset
+	// +optional
+	Create *metav1.Duration `json:"create,omitempty"`
+
+	// Delete is the timeout of machine deletion, 30m when unset
+	// +optional
+	Delete *metav1.Duration `json:"delete,omitempty"`
+
+	// Resize is the timeout of flavor changes, 30m when unset
+	// +optional
+	Resize *metav1.Duration `json:"resize,omitempty"`
+
+	// Power is the timeout of power on, power off, shutdown and suspend,
+	// 10m when unset
+	// +optional
+	Power *metav1.Duration `json:"power,omitempty"`
+}
+
+// SecretReference selects a Secret
+type SecretReference struct {
+	// Name of the Secret
+	Name string `json:"name"`
+
+	// Namespace of the Secret
+	Namespace string `json:"namespace"`
+}
+
+// CABundleReference selects a key of a ConfigMap or Secret holding a PEM
+// encoded CA bundle
+type CABundleReference struct {
+	// Kind of the object, ConfigMap or Secret
+	// +kubebuilder:validation:Enum=ConfigMap;Secret
+	Kind string `json:"kind"`
+
+	// Name of the object
+	Name string `json:"name"`
+
+	// Namespace of the object
+	Namespace string `json:"namespace"`
+
+	// Key within the object
+	Key string `json:"key"`
+}
+
+// TLSConfig configures the TLS connection to vRealize Automation, it applies
+// to the login as well as the API calls
+type TLSConfig struct {
+	// PEM encoded CA bundle trusted in addition to the system roots
+	// +optional
+	CABundle []byte `json:"caBundle,omitempty"`
+
+	// CABundleRef selects a ConfigMap or Secret key holding a CA bundle,
+	// trusted in addition to CABundle
+	// +optional
+	CABundleRef *CABundleReference `json:"caBundleRef,omitempty"`
+
+	// ClientCertificateSecretRef selects a kubernetes.io/tls Secret whose
+	// tls.crt and tls.key are presented as client certificate
+	// +optional
+	ClientCertificateSecretRef *SecretReference `json:"clientCertificateSecretRef,omitempty"`
+
+	// MinVersion is the minimum TLS version accepted, defaults to 1.2
+	// +kubebuilder:validation:Enum="1.0";"1.1";"1.2";"1.3"
+	// +optional
+	MinVersion string `json:"minVersion,omitempty"`
+
+	// InsecureSkipVerify disables verification of the vRealize Automation
+	// certificate
+	// +optional
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+}
+
+// AuthMode selects how to log in to vRealize Automation
+type AuthMode string
+
+// AuthMode constants
+const (
+	// RefreshTokenAuthMode exchanges an API refresh token for access tokens
+	RefreshTokenAuthMode AuthMode = "RefreshToken"
+	// PasswordAuthMode logs in to the identity service of an on-prem vRA 8
+	// appliance with a username and password
+	PasswordAuthMode AuthMode = "Password"
+)
+
+// SecretKeyReference selects a key of a Secret
+type SecretKeyReference struct {
+	// Name of the Secret
+	Name string `json:"name"`
+
+	// Namespace of the Secret
+	Namespace string `json:"namespace"`
+
+	// Key within the Secret
+	Key string `json:"key"`
 }
 
 func init() {
@@ -0,0 +1,235 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"encoding/json"
+
+	"github.com/vmware/vra-sdk-go/pkg/models"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"github.com/sammcgeown/vra/api/v1alpha2"
+)
+
+// preservedSpecAnnotation holds the v1alpha1 spec fields that have no place
+// in v1alpha2, so that converting back and forth does not lose them
+const preservedSpecAnnotation = "machine.cmbu.local/v1alpha1-spec"
+
+// hubDataAnnotation holds the v1alpha2 spec and status of an object read as
+// v1alpha1 when they carry fields that v1alpha1 has no place for
+const hubDataAnnotation = "machine.cmbu.local/v1alpha2-data"
+
+// preservedSpec are the v1alpha1 spec fields kept in preservedSpecAnnotation
+type preservedSpec struct {
+	Href           string `json:"href,omitempty"`
+	OrganizationID string `json:"organizationId,omitempty"`
+}
+
+// hubData is the content of hubDataAnnotation
+type hubData struct {
+	Spec   v1alpha2.VirtualMachineSpec   `json:"spec"`
+	Status v1alpha2.VirtualMachineStatus `json:"status"`
+}
+
+// ConvertTo converts this VirtualMachine to the hub version. The vRA fields
+// that v1alpha1 keeps in the spec move to status.machine.
+func (src *VirtualMachine) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1alpha2.VirtualMachine)
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.Spec = v1alpha2.VirtualMachineSpec{}
+	dst.Status = v1alpha2.VirtualMachineStatus{}
+	if data, ok := dst.Annotations[hubDataAnnotation]; ok {
+		var hub hubData
+		if err := json.Unmarshal([]byte(data), &hub); err != nil {
+			return err
+		}
+		dst.Spec, dst.Status = hub.Spec, hub.Status
+		delete(dst.Annotations, hubDataAnnotation)
+	}
+
+	preserved := preservedSpec{
+		Href:           src.Spec.Href,
+		OrganizationID: src.Spec.OrganizationID,
+	}
+	if preserved != (preservedSpec{}) {
+		data, err := json.Marshal(preserved)
+		if err != nil {
+			return err
+		}
+		if dst.Annotations == nil {
+			dst.Annotations = map[string]string{}
+		}
+		dst.Annotations[preservedSpecAnnotation] = string(data)
+	}
+	if len(dst.Annotations) == 0 {
+		dst.Annotations = nil
+	}
+
+	dst.Spec.ProjectID = src.Spec.ProjectID
+	dst.Spec.Flavor = src.Spec.Flavor
+	dst.Spec.Image = src.Spec.Image
+	dst.Spec.Description = src.Spec.Description
+	dst.Spec.CustomProperties = src.Spec.CustomProperties
+	dst.Spec.EndpointName = src.Spec.EndpointName
+	dst.Spec.Constraints = nil
+	for _, constraint := range src.Spec.Constraints {
+		dst.Spec.Constraints = append(dst.Spec.Constraints, v1alpha2.Constraint(constraint))
+	}
+	dst.Spec.Tags = nil
+	for _, tag := range src.Spec.Tags {
+		dst.Spec.Tags = append(dst.Spec.Tags, v1alpha2.Tag(tag))
+	}
+	if src.Spec.BootConfig != nil {
+		if dst.Spec.BootConfig == nil {
+			dst.Spec.BootConfig = &v1alpha2.BootConfig{}
+		}
+		dst.Spec.BootConfig.Content = src.Spec.BootConfig.Content
+	} else if dst.Spec.BootConfig != nil && dst.Spec.BootConfig.Content != "" {
+		// The inline content was removed through v1alpha1
+		dst.Spec.BootConfig = nil
+	}
+
+	dst.Status.Phase = v1alpha2.StatusPhase(src.Status.Phase)
+	dst.Status.LastMessage = src.Status.LastMessage
+	dst.Status.ExternalRequestID = src.Status.ExternalRequestID
+	dst.Status.ExternalID = src.Status.ExternalID
+	dst.Status.Conditions = src.Status.Conditions
+	dst.Status.ObservedGeneration = src.Status.ObservedGeneration
+	if src.Status.ExternalRequestID == "" {
+		dst.Status.Operation = ""
+		dst.Status.RequestedFlavor = ""
+	}
+	if src.Spec.ID == nil {
+		dst.Status.Machine = nil
+		return nil
+	}
+	if dst.Status.Machine == nil {
+		dst.Status.Machine = &v1alpha2.MachineStatus{}
+	}
+	machine := dst.Status.Machine
+	machine.ID = *src.Spec.ID
+	machine.Address = src.Spec.Address
+	machine.Hostname = src.Spec.Hostname
+	machine.PowerState = v1alpha2.PowerState(stringValue(src.Spec.PowerState))
+	machine.ExternalID = src.Spec.ExternalID
+	machine.ExternalRegionID = stringValue(src.Spec.ExternalRegionID)
+	machine.ExternalZoneID = stringValue(src.Spec.ExternalZoneID)
+	machine.CloudAccountIds = src.Spec.CloudAccountIds
+	machine.DeploymentID = src.Spec.DeploymentID
+	machine.ProjectID = src.Spec.ProjectID
+	machine.OrgID = src.Spec.OrgID
+	machine.Owner = src.Spec.Owner
+	machine.CreatedAt = src.Spec.CreatedAt
+	machine.UpdatedAt = src.Spec.UpdatedAt
+	return nil
+}
+
+// ConvertFrom converts from the hub version to this version, filling the
+// spec with the vRA fields recorded in status.machine
+func (dst *VirtualMachine) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1alpha2.VirtualMachine)
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	var preserved preservedSpec
+	if data, ok := dst.Annotations[preservedSpecAnnotation]; ok {
+		if err := json.Unmarshal([]byte(data), &preserved); err != nil {
+			return err
+		}
+		delete(dst.Annotations, preservedSpecAnnotation)
+		if len(dst.Annotations) == 0 {
+			dst.Annotations = nil
+		}
+	}
+
+	dst.Spec = VirtualMachineSpec{
+		Href:             preserved.Href,
+		OrganizationID:   preserved.OrganizationID,
+		ProjectID:        src.Spec.ProjectID,
+		Flavor:           src.Spec.Flavor,
+		Image:            src.Spec.Image,
+		Description:      src.Spec.Description,
+		CustomProperties: src.Spec.CustomProperties,
+		EndpointName:     src.Spec.EndpointName,
+	}
+	for _, constraint := range src.Spec.Constraints {
+		dst.Spec.Constraints = append(dst.Spec.Constraints, Constraint(constraint))
+	}
+	for _, tag := range src.Spec.Tags {
+		dst.Spec.Tags = append(dst.Spec.Tags, Tag(tag))
+	}
+	if bootConfig := src.Spec.BootConfig; bootConfig != nil && bootConfig.Content != "" {
+		dst.Spec.BootConfig = &models.MachineBootConfig{Content: bootConfig.Content}
+	}
+	if machine := src.Status.Machine; machine != nil {
+		dst.Spec.ID = stringPointer(machine.ID)
+		dst.Spec.Address = machine.Address
+		dst.Spec.Hostname = machine.Hostname
+		dst.Spec.PowerState = stringPointer(string(machine.PowerState))
+		dst.Spec.ExternalID = machine.ExternalID
+		dst.Spec.ExternalRegionID = stringPointer(machine.ExternalRegionID)
+		dst.Spec.ExternalZoneID = stringPointer(machine.ExternalZoneID)
+		dst.Spec.CloudAccountIds = machine.CloudAccountIds
+		dst.Spec.DeploymentID = machine.DeploymentID
+		dst.Spec.OrgID = machine.OrgID
+		dst.Spec.Owner = machine.Owner
+		dst.Spec.CreatedAt = machine.CreatedAt
+		dst.Spec.UpdatedAt = machine.UpdatedAt
+	}
+
+	dst.Status = VirtualMachineStatus{
+		Phase:              StatusPhase(src.Status.Phase),
+		LastMessage:        src.Status.LastMessage,
+		ExternalRequestID:  src.Status.ExternalRequestID,
+		ExternalID:         src.Status.ExternalID,
+		Conditions:         src.Status.Conditions,
+		ObservedGeneration: src.Status.ObservedGeneration,
+	}
+
+	// Keep whatever v1alpha1 cannot represent
+	var roundTrip v1alpha2.VirtualMachine
+	if err := dst.ConvertTo(&roundTrip); err != nil {
+		return err
+	}
+	if !equality.Semantic.DeepEqual(roundTrip.Spec, src.Spec) || !equality.Semantic.DeepEqual(roundTrip.Status, src.Status) {
+		data, err := json.Marshal(hubData{Spec: src.Spec, Status: src.Status})
+		if err != nil {
+			return err
+		}
+		if dst.Annotations == nil {
+			dst.Annotations = map[string]string{}
+		}
+		dst.Annotations[hubDataAnnotation] = string(data)
+	}
+	return nil
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// stringPointer returns nil for an empty string
+func stringPointer(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
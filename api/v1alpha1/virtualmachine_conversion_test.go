@@ -0,0 +1,137 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/vmware/vra-sdk-go/pkg/models"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/sammcgeown/vra/api/v1alpha2"
+)
+
+var _ = Describe("VirtualMachine conversion", func() {
+	str := func(s string) *string { return &s }
+
+	original := func() *VirtualMachine {
+		return &VirtualMachine{
+			ObjectMeta: metav1.ObjectMeta{Name: "vm-one", Namespace: "default", Annotations: map[string]string{"team": "a"}},
+			Spec: VirtualMachineSpec{
+				Href:             "/iaas/api/machines/machine-1",
+				ProjectID:        "project",
+				Flavor:           "small",
+				Image:            "ubuntu-18",
+				Description:      "Created from a Kubernetes CRD",
+				CustomProperties: map[string]string{"property": "value"},
+				Constraints:      []Constraint{{Mandatory: true, Expression: "env:vsphere"}},
+				Tags:             []Tag{{Key: "custom-tag", Value: "my-tag-value"}},
+				BootConfig:       &models.MachineBootConfig{Content: "#cloud-config"},
+
+				ID:               str("machine-1"),
+				Address:          "10.0.0.1",
+				Hostname:         "vm-one",
+				PowerState:       str("ON"),
+				ExternalID:       "vm-123",
+				ExternalRegionID: str("region"),
+				ExternalZoneID:   str("zone"),
+				CloudAccountIds:  []string{"cloud-account"},
+				OrgID:            "org",
+				Owner:            "owner@example.com",
+				CreatedAt:        "2022-01-01",
+				UpdatedAt:        "2022-01-02",
+			},
+			Status: VirtualMachineStatus{Phase: RunningStatusPhase, LastMessage: "ready", ExternalID: "machine-1"},
+		}
+	}
+
+	It("moves the vRA fields to status", func() {
+		var hub v1alpha2.VirtualMachine
+		Expect(original().ConvertTo(&hub)).To(Succeed())
+
+		Expect(hub.Spec.ProjectID).To(Equal("project"))
+		Expect(hub.Spec.Constraints).To(Equal([]v1alpha2.Constraint{{Mandatory: true, Expression: "env:vsphere"}}))
+		Expect(hub.Status.ExternalID).To(Equal("machine-1"))
+		Expect(hub.Status.Machine).NotTo(BeNil())
+		Expect(hub.Status.Machine.Address).To(Equal("10.0.0.1"))
+		Expect(hub.Status.Machine.PowerState).To(Equal(v1alpha2.OnPowerState))
+		Expect(hub.Status.Machine.ExternalZoneID).To(Equal("zone"))
+		Expect(hub.Spec.BootConfig).To(Equal(&v1alpha2.BootConfig{Content: "#cloud-config"}))
+		Expect(hub.Annotations).To(HaveKey(preservedSpecAnnotation))
+	})
+
+	It("round trips through the hub version", func() {
+		var hub v1alpha2.VirtualMachine
+		Expect(original().ConvertTo(&hub)).To(Succeed())
+
+		var converted VirtualMachine
+		Expect(converted.ConvertFrom(&hub)).To(Succeed())
+		Expect(&converted).To(Equal(original()))
+	})
+
+	It("keeps v1alpha2 only fields when read as v1alpha1", func() {
+		var hub v1alpha2.VirtualMachine
+		Expect(original().ConvertTo(&hub)).To(Succeed())
+		hub.Spec.PowerState = v1alpha2.OffPowerState
+		hub.Status.ExternalRequestID = "request-1"
+		hub.Status.Operation = v1alpha2.PowerOffOperation
+		expected := hub.DeepCopy()
+
+		var spoke VirtualMachine
+		Expect(spoke.ConvertFrom(&hub)).To(Succeed())
+		Expect(spoke.Annotations).To(HaveKey(hubDataAnnotation))
+		Expect(*spoke.Spec.PowerState).To(Equal("ON"))
+
+		var converted v1alpha2.VirtualMachine
+		Expect(spoke.ConvertTo(&converted)).To(Succeed())
+		Expect(&converted).To(Equal(expected))
+	})
+
+	It("keeps a boot config read from a Secret when read as v1alpha1", func() {
+		var hub v1alpha2.VirtualMachine
+		Expect(original().ConvertTo(&hub)).To(Succeed())
+		hub.Spec.BootConfig = &v1alpha2.BootConfig{SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "cloud-init"},
+			Key:                  "user-data",
+		}}
+		expected := hub.DeepCopy()
+
+		var spoke VirtualMachine
+		Expect(spoke.ConvertFrom(&hub)).To(Succeed())
+		Expect(spoke.Spec.BootConfig).To(BeNil())
+
+		var converted v1alpha2.VirtualMachine
+		Expect(spoke.ConvertTo(&converted)).To(Succeed())
+		Expect(&converted).To(Equal(expected))
+	})
+
+	It("leaves the vRA fields unset before the machine exists", func() {
+		vm := original()
+		vm.Spec = VirtualMachineSpec{ProjectID: "project", Flavor: "small", Image: "ubuntu-18"}
+		vm.Annotations = nil
+
+		var hub v1alpha2.VirtualMachine
+		Expect(vm.ConvertTo(&hub)).To(Succeed())
+		Expect(hub.Status.Machine).To(BeNil())
+		Expect(hub.Annotations).To(BeEmpty())
+
+		var converted VirtualMachine
+		Expect(converted.ConvertFrom(&hub)).To(Succeed())
+		Expect(&converted).To(Equal(vm))
+	})
+})
@@ -46,6 +46,43 @@ const (
 	SuspendPowerState  PowerState = "SUSPEND"
 )
 
+// VirtualMachine condition types, Ready is shared with VRAEndpoint
+const (
+	// ProvisionedCondition is true once the machine exists in vRA
+	ProvisionedCondition = "Provisioned"
+	// RequestInProgressCondition is true while a vRA request is running
+	RequestInProgressCondition = "RequestInProgress"
+	// SyncedCondition is true when the last lookup of the machine in vRA
+	// succeeded and its state was recorded
+	SyncedCondition = "Synced"
+	// DeletingCondition is true while the machine is removed from vRA
+	DeletingCondition = "Deleting"
+	// CredentialsValidCondition is false when no logged in vRA client is
+	// available for the machine
+	CredentialsValidCondition = "CredentialsValid"
+)
+
+// VirtualMachine condition reasons
+const (
+	ClientAvailableReason     = "ClientAvailable"
+	ClientUnavailableReason   = "ClientUnavailable"
+	ProvisioningReason        = "Provisioning"
+	ProvisioningFailedReason  = "ProvisioningFailed"
+	MachineFoundReason        = "MachineFound"
+	MachineReadyReason        = "MachineReady"
+	RequestSubmittedReason    = "RequestSubmitted"
+	RequestRunningReason      = "RequestRunning"
+	RequestFinishedReason     = "RequestFinished"
+	RequestFailedReason       = "RequestFailed"
+	RequestTrackerErrorReason = "RequestTrackerError"
+	LookupFailedReason        = "LookupFailed"
+	MultipleMachinesReason    = "MultipleMachinesFound"
+	UpdateFailedReason        = "UpdateFailed"
+	SyncedReason              = "Synced"
+	DeletionRequestedReason   = "DeletionRequested"
+	DeletionFailedReason      = "DeletionFailed"
+)
+
 // VirtualMachineSpec defines the desired state of VirtualMachine
 type VirtualMachineSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
@@ -168,6 +205,11 @@ type VirtualMachineSpec struct {
 	// Label tags
 	// +optional
 	Tags []Tag `json:"tags"`
+
+	// Name of the VRAEndpoint to create the machine in, the connection from
+	// the controller configuration is used when empty
+	// +optional
+	EndpointName string `json:"endpointName,omitempty"`
 }
 
 // Constraint are the constraint tags for a virtual machine
@@ -188,10 +230,22 @@ type VirtualMachineStatus struct {
 	LastMessage       string      `json:"lastMessage"`
 	ExternalRequestID string      `json:"externalRequestID"`
 	ExternalID        string      `json:"externalID"`
+
+	// Conditions describe the state of the machine, see the condition type
+	// constants
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// ObservedGeneration is the generation last acted on by the controller
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
 // +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
 // +kubebuilder:printcolumn:name="External_ID",type=string,JSONPath=`.status.externalID`
 // +kubebuilder:printcolumn:name="External_Request_ID",type=string,JSONPath=`.status.externalRequestID`
@@ -0,0 +1,101 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// VRAEndpoint condition types and reasons
+const (
+	ReadyCondition = "Ready"
+
+	LoginSucceededReason      = "LoginSucceeded"
+	LoginFailedReason         = "LoginFailed"
+	CredentialsNotFoundReason = "CredentialsNotFound"
+)
+
+// VRAEndpointSpec defines the desired state of VRAEndpoint
+type VRAEndpointSpec struct {
+	// URL of the vRealize Automation API
+	// Example: https://api.mgmt.cloud.vmware.com
+	URL string `json:"url"`
+
+	// AuthMode selects how to log in. RefreshToken uses an API token, Password
+	// logs in to the identity service of an on-prem vRA 8 appliance.
+	// +kubebuilder:validation:Enum=RefreshToken;Password
+	// +kubebuilder:default=RefreshToken
+	// +optional
+	AuthMode AuthMode `json:"authMode,omitempty"`
+
+	// Username to log in with when AuthMode is Password
+	// +optional
+	Username string `json:"username,omitempty"`
+
+	// Domain of the user when AuthMode is Password
+	// Example: System Domain
+	// +optional
+	Domain string `json:"domain,omitempty"`
+
+	// CredentialsSecretRef selects the Secret key holding the refresh token,
+	// or the password when AuthMode is Password. The Secret is watched and the
+	// client is rebuilt when it changes.
+	CredentialsSecretRef SecretKeyReference `json:"credentialsSecretRef"`
+
+	// TLS settings for the connection to the endpoint
+	// +optional
+	TLS *TLSConfig `json:"tls,omitempty"`
+}
+
+// VRAEndpointStatus defines the observed state of VRAEndpoint
+type VRAEndpointStatus struct {
+	// Conditions describe the state of the connection to vRealize Automation
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// ObservedGeneration is the generation last reconciled
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="URL",type=string,JSONPath=`.spec.url`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+
+// VRAEndpoint is the Schema for the vraendpoints API
+type VRAEndpoint struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   VRAEndpointSpec   `json:"spec,omitempty"`
+	Status VRAEndpointStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// VRAEndpointList contains a list of VRAEndpoint
+type VRAEndpointList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []VRAEndpoint `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&VRAEndpoint{}, &VRAEndpointList{})
+}
@@ -0,0 +1,641 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// StatusPhase is a string representation of the status phase
+type StatusPhase string
+
+// PowerState is a string representation of the power state
+type PowerState string
+
+// Operation is the kind of vRA request being tracked
+type Operation string
+
+// DiskState is the state of a disk of the machine
+type DiskState string
+
+// RemoteAccessAuthentication is how users log in to the machine
+type RemoteAccessAuthentication string
+
+// DeletionPolicy is what happens to the machine when the VirtualMachine is
+// deleted
+type DeletionPolicy string
+
+// StatusPhase constants
+const (
+	RunningStatusPhase    StatusPhase = "RUNNING"
+	CreatingStatusPhase   StatusPhase = "CREATING"
+	PendingStatusPhase    StatusPhase = "PENDING"
+	ErrorStatusPhase      StatusPhase = "ERROR"
+	InProgressStatusPhase StatusPhase = "INPROGRESS"
+
+	OnPowerState       PowerState = "ON"
+	OffPowerState      PowerState = "OFF"
+	GuestOffPowerState PowerState = "GUEST_OFF"
+	UnknownPowerState  PowerState = "UNKNOWN"
+	SuspendPowerState  PowerState = "SUSPEND"
+)
+
+// Operation constants
+const (
+	CreateOperation   Operation = "Create"
+	DeleteOperation   Operation = "Delete"
+	PowerOnOperation  Operation = "PowerOn"
+	PowerOffOperation Operation = "PowerOff"
+	ShutdownOperation Operation = "Shutdown"
+	SuspendOperation  Operation = "Suspend"
+	ResizeOperation   Operation = "Resize"
+
+	CreateDiskOperation Operation = "CreateDisk"
+	AttachDiskOperation Operation = "AttachDisk"
+	ResizeDiskOperation Operation = "ResizeDisk"
+	DetachDiskOperation Operation = "DetachDisk"
+	DeleteDiskOperation Operation = "DeleteDisk"
+)
+
+// DiskState constants, a disk is in one of the transitional states while the
+// operation changing it runs
+const (
+	CreatingDiskState  DiskState = "Creating"
+	AvailableDiskState DiskState = "Available"
+	AttachingDiskState DiskState = "Attaching"
+	AttachedDiskState  DiskState = "Attached"
+	ResizingDiskState  DiskState = "Resizing"
+	DetachingDiskState DiskState = "Detaching"
+	DeletingDiskState  DiskState = "Deleting"
+)
+
+// RemoteAccessAuthentication constants
+const (
+	// GeneratedKeyPairAuthentication installs the public key of a key pair
+	// generated by the controller, the private key is written to a Secret
+	GeneratedKeyPairAuthentication RemoteAccessAuthentication = "GeneratedKeyPair"
+	// PublicKeyAuthentication installs a public key read from a Secret
+	PublicKeyAuthentication RemoteAccessAuthentication = "PublicKey"
+	// UsernamePasswordAuthentication sets a username and password read from
+	// a Secret
+	UsernamePasswordAuthentication RemoteAccessAuthentication = "UsernamePassword"
+)
+
+// DeletionPolicy constants
+const (
+	// DeleteDeletionPolicy deletes the machine from vRA
+	DeleteDeletionPolicy DeletionPolicy = "Delete"
+	// OrphanDeletionPolicy leaves the machine in vRA as it is, without the
+	// tags that tie it to the VirtualMachine
+	OrphanDeletionPolicy DeletionPolicy = "Orphan"
+	// PowerOffAndRetainDeletionPolicy powers the machine off and then leaves
+	// it in vRA like OrphanDeletionPolicy
+	PowerOffAndRetainDeletionPolicy DeletionPolicy = "PowerOffAndRetain"
+)
+
+// VirtualMachine condition types
+const (
+	// ReadyCondition is true when the machine exists and no request is
+	// running against it
+	ReadyCondition = "Ready"
+	// ProvisionedCondition is true once the machine exists in vRA
+	ProvisionedCondition = "Provisioned"
+	// RequestInProgressCondition is true while a vRA request is running
+	RequestInProgressCondition = "RequestInProgress"
+	// SyncedCondition is true when the last lookup of the machine in vRA
+	// succeeded and its state was recorded
+	SyncedCondition = "Synced"
+	// DeletingCondition is true while the machine is removed from vRA
+	DeletingCondition = "Deleting"
+	// CredentialsValidCondition is false when no logged in vRA client is
+	// available for the machine
+	CredentialsValidCondition = "CredentialsValid"
+	// FlavorSyncedCondition is true when the machine has the flavor in the
+	// spec
+	FlavorSyncedCondition = "FlavorSynced"
+	// DisksSyncedCondition is true when the disks of the machine match the
+	// spec
+	DisksSyncedCondition = "DisksSynced"
+	// TagsSyncedCondition is true when the machine carries the tags in the
+	// spec, tags changed in vRA are re-applied
+	TagsSyncedCondition = "TagsSynced"
+	// ConnectionDetailsPublishedCondition is true once the connection
+	// details of the machine are written to the connection secret
+	ConnectionDetailsPublishedCondition = "ConnectionDetailsPublished"
+	// FailedCondition is true when the last vRA request failed or timed
+	// out, it is cleared once a later request finishes
+	FailedCondition = "Failed"
+)
+
+// VirtualMachine condition reasons
+const (
+	ClientAvailableReason             = "ClientAvailable"
+	ClientUnavailableReason           = "ClientUnavailable"
+	ProvisioningReason                = "Provisioning"
+	ProvisioningFailedReason          = "ProvisioningFailed"
+	MachineFoundReason                = "MachineFound"
+	MachineReadyReason                = "MachineReady"
+	RequestSubmittedReason            = "RequestSubmitted"
+	RequestRunningReason              = "RequestRunning"
+	RequestFinishedReason             = "RequestFinished"
+	RequestFailedReason               = "RequestFailed"
+	RequestTrackerErrorReason         = "RequestTrackerError"
+	LookupFailedReason                = "LookupFailed"
+	MultipleMachinesReason            = "MultipleMachinesFound"
+	SyncedReason                      = "Synced"
+	DeletionRequestedReason           = "DeletionRequested"
+	DeletionFailedReason              = "DeletionFailed"
+	OperationFailedReason             = "OperationFailed"
+	FlavorMatchesReason               = "FlavorMatches"
+	ResizingReason                    = "Resizing"
+	ResizeFailedReason                = "ResizeFailed"
+	PowerOffRequiredReason            = "PowerOffRequired"
+	DisksMatchReason                  = "DisksMatch"
+	UpdatingDisksReason               = "UpdatingDisks"
+	DiskOperationFailedReason         = "DiskOperationFailed"
+	DiskShrinkReason                  = "DiskShrinkUnsupported"
+	InvalidSpecReason                 = "InvalidSpec"
+	ConnectionSecretReason            = "ConnectionSecretFailed"
+	TagsMatchReason                   = "TagsMatch"
+	TagsReappliedReason               = "TagsReapplied"
+	TagUpdateFailedReason             = "TagUpdateFailed"
+	AdoptionFailedReason              = "AdoptionFailed"
+	DeletionProtectedReason           = "DeletionProtected"
+	RequestTimedOutReason             = "RequestTimedOut"
+	ConnectionSecretWrittenReason     = "ConnectionSecretWritten"
+	CredentialsSecretRefMissingReason = "CredentialsSecretRefMissing"
+)
+
+// VirtualMachineSpec defines the desired state of VirtualMachine
+type VirtualMachineSpec struct {
+	// The id of the project to create the machine in.
+	// Example: 9e49
+	ProjectID string `json:"projectId"`
+
+	// Flavor of the machine
+	// Example: small
+	Flavor string `json:"flavor"`
+
+	// Image of the machine, one of image and imageRef is set unless the
+	// machine is adopted
+	// Example: ubuntu-18
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// ImageRef is a direct reference to the image of the machine on the
+	// cloud provider (name, path, location, uri), used instead of image
+	// Example: ami-f6795a8c
+	// +optional
+	ImageRef string `json:"imageRef,omitempty"`
+
+	// Constraint tags used to place the image disk of the machine
+	// +optional
+	ImageDiskConstraints []Constraint `json:"imageDiskConstraints,omitempty"`
+
+	// A human-friendly description.
+	// Example: my-description
+	// +optional
+	Description string `json:"description,omitempty"`
+
+	// Additional properties that may be used to extend the base resource.
+	// Example: { \"property\" : \"value\" }
+	// +optional
+	CustomProperties map[string]string `json:"customProperties,omitempty"`
+
+	// Constraint tags used for placement
+	// +optional
+	Constraints []Constraint `json:"constraints,omitempty"`
+
+	// Label tags
+	// +optional
+	Tags []Tag `json:"tags,omitempty"`
+
+	// Name of the VRAEndpoint to create the machine in, the connection from
+	// the controller configuration is used when empty
+	// +optional
+	EndpointName string `json:"endpointName,omitempty"`
+
+	// AdoptMachineID is the id of an existing vRA machine to manage instead
+	// of creating one. The machine must belong to projectId and not be
+	// managed by another VirtualMachine, it is tagged like the machines the
+	// controller creates. It is only used until the machine is found.
+	// +optional
+	AdoptMachineID string `json:"adoptMachineID,omitempty"`
+
+	// DeletionPolicy is what happens to the machine when the VirtualMachine
+	// is deleted, the default of the controller configuration applies when
+	// empty and Delete when neither is set
+	// +kubebuilder:validation:Enum=Delete;Orphan;PowerOffAndRetain
+	// +optional
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+
+	// DeletionProtection refuses the deletion of the VirtualMachine, and
+	// holds back the removal of its machine, until it is cleared
+	// +optional
+	DeletionProtection bool `json:"deletionProtection,omitempty"`
+
+	// PowerState the machine should be kept in. OFF powers the machine off,
+	// GUEST_OFF shuts the guest OS down. The power state is left alone when
+	// empty.
+	// +kubebuilder:validation:Enum=ON;OFF;GUEST_OFF;SUSPEND
+	// +optional
+	PowerState PowerState `json:"powerState,omitempty"`
+
+	// ResizeRequiresPowerOff holds a flavor change back until the machine is
+	// powered off, for clouds that cannot resize running machines
+	// +optional
+	ResizeRequiresPowerOff bool `json:"resizeRequiresPowerOff,omitempty"`
+
+	// Disks attached to the machine besides its boot disk. They are created
+	// and attached before the machine is provisioned, and added, grown or
+	// detached when the list changes. Only the capacity of an existing disk
+	// can be changed.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Disks []Disk `json:"disks,omitempty"`
+
+	// NetworkInterfaces of the machine, vRA attaches its default network when
+	// empty. They are only used when the machine is created.
+	// +optional
+	NetworkInterfaces []NetworkInterface `json:"networkInterfaces,omitempty"`
+
+	// BootConfig is the cloud-config the machine is created with
+	// +optional
+	BootConfig *BootConfig `json:"bootConfig,omitempty"`
+
+	// RemoteAccess sets how users log in to the machine, it is only used
+	// when the machine is created
+	// +optional
+	RemoteAccess *RemoteAccess `json:"remoteAccess,omitempty"`
+
+	// WriteConnectionSecretToRef names a Secret or ConfigMap in the namespace
+	// of the VirtualMachine that the controller keeps the connection details
+	// of the machine in, for workloads to mount. A ConfigMap gets no
+	// credentials.
+	// +optional
+	WriteConnectionSecretToRef *ConnectionSecretReference `json:"writeConnectionSecretToRef,omitempty"`
+}
+
+// ConnectionSecretReference names the Secret or ConfigMap the connection
+// details are written to
+type ConnectionSecretReference struct {
+	// Kind of the object, Secret or ConfigMap
+	// +kubebuilder:validation:Enum=Secret;ConfigMap
+	// +kubebuilder:default=Secret
+	// +optional
+	Kind string `json:"kind,omitempty"`
+
+	// Name of the object
+	Name string `json:"name"`
+}
+
+// RemoteAccess are the settings to log in to the machine. AWS and vSphere
+// support key pairs, Azure supports key pairs and username/password.
+type RemoteAccess struct {
+	// Authentication is how users log in to the machine
+	// +kubebuilder:validation:Enum=GeneratedKeyPair;PublicKey;UsernamePassword
+	Authentication RemoteAccessAuthentication `json:"authentication"`
+
+	// PublicKeySecretRef selects the key of a Secret holding the public key
+	// to install, for PublicKey authentication
+	// +optional
+	PublicKeySecretRef *corev1.SecretKeySelector `json:"publicKeySecretRef,omitempty"`
+
+	// CredentialsSecretRef names a Secret with username and password keys,
+	// for UsernamePassword authentication
+	// +optional
+	CredentialsSecretRef *corev1.LocalObjectReference `json:"credentialsSecretRef,omitempty"`
+
+	// Username to log in with when the image has a default user for key
+	// pairs, it is only written to the connection secret. The username of
+	// UsernamePassword authentication is read from its Secret.
+	// Example: ubuntu
+	// +optional
+	Username string `json:"username,omitempty"`
+
+	// Port the machine accepts remote logins on, 22 when unset. It is only
+	// written to the connection secret.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	Port int32 `json:"port,omitempty"`
+}
+
+// BootConfig is the cloud-config of the machine, inline or read from a
+// ConfigMap or Secret in the namespace of the VirtualMachine. Exactly one of
+// the sources is set. The content is a Go template given the .Name,
+// .Namespace and .Labels of the VirtualMachine, for example
+// "hostname: {{ .Name }}". It is only used when the machine is created.
+type BootConfig struct {
+	// Content is the inline cloud-config
+	// +optional
+	Content string `json:"content,omitempty"`
+
+	// ConfigMapKeyRef selects the key of a ConfigMap holding the cloud-config
+	// +optional
+	ConfigMapKeyRef *corev1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty"`
+
+	// SecretKeyRef selects the key of a Secret holding the cloud-config, for
+	// content carrying credentials or keys
+	// +optional
+	SecretKeyRef *corev1.SecretKeySelector `json:"secretKeyRef,omitempty"`
+}
+
+// Disk is a block device attached to the machine
+type Disk struct {
+	// Name of the disk, unique within the machine
+	Name string `json:"name"`
+
+	// Capacity of the disk in GB, it can grow but not shrink
+	// +kubebuilder:validation:Minimum=1
+	CapacityInGB int32 `json:"capacityInGB"`
+
+	// A human-friendly description.
+	// +optional
+	Description string `json:"description,omitempty"`
+
+	// Constraint tags used to place the disk on storage
+	// +optional
+	Constraints []Constraint `json:"constraints,omitempty"`
+
+	// Encrypted disks are encrypted by the cloud provider
+	// +optional
+	Encrypted bool `json:"encrypted,omitempty"`
+
+	// Persistent disks are kept in vRA when they are detached or the machine
+	// is deleted
+	// +optional
+	Persistent bool `json:"persistent,omitempty"`
+}
+
+// Constraint are the constraint tags for a virtual machine
+type Constraint struct {
+	Mandatory  bool   `json:"mandatory"`
+	Expression string `json:"expression"`
+}
+
+// Tag are the label tags for a virtual machine
+type Tag struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// MachineStatus is the state of the machine as last seen in vRA
+type MachineStatus struct {
+	// The id of the machine in vRA
+	// Example: 9e49
+	ID string `json:"id,omitempty"`
+
+	// Primary address allocated or in use by this machine. The actual type of the address depends on the adapter type. Typically it is either the public or the external IP address.
+	// Example: 34.242.21.5
+	// +optional
+	Address string `json:"address,omitempty"`
+
+	// Hostname associated with this machine instance.
+	// +optional
+	Hostname string `json:"hostname,omitempty"`
+
+	// Power state of machine.
+	// +optional
+	PowerState PowerState `json:"powerState,omitempty"`
+
+	// Flavor of the machine, as reported by vRA or else as last created or
+	// resized by the controller.
+	// +optional
+	Flavor string `json:"flavor,omitempty"`
+
+	// External entity Id on the provider side.
+	// Example: i-cfe4-e241-e53b-756a9a2e25d2
+	// +optional
+	ExternalID string `json:"externalId,omitempty"`
+
+	// The external regionId of the resource.
+	// Example: us-east-1
+	// +optional
+	ExternalRegionID string `json:"externalRegionId,omitempty"`
+
+	// The external zoneId of the resource.
+	// Example: us-east-1a
+	// +optional
+	ExternalZoneID string `json:"externalZoneId,omitempty"`
+
+	// Set of ids of the cloud accounts this resource belongs to.
+	// +optional
+	CloudAccountIds []string `json:"cloudAccountIds,omitempty"`
+
+	// Deployment id that is associated with this resource.
+	// +optional
+	DeploymentID string `json:"deploymentId,omitempty"`
+
+	// The id of the project the machine belongs to.
+	// +optional
+	ProjectID string `json:"projectId,omitempty"`
+
+	// The id of the organization the machine belongs to.
+	// +optional
+	OrgID string `json:"orgId,omitempty"`
+
+	// Email of the user that owns the machine.
+	// +optional
+	Owner string `json:"owner,omitempty"`
+
+	// Date when the machine was created. The date is in ISO 8601 and UTC.
+	// +optional
+	CreatedAt string `json:"createdAt,omitempty"`
+
+	// Date when the machine was last updated. The date is ISO 8601 and UTC.
+	// +optional
+	UpdatedAt string `json:"updatedAt,omitempty"`
+
+	// Network interfaces of the machine
+	// +optional
+	NetworkInterfaces []NetworkInterfaceStatus `json:"networkInterfaces,omitempty"`
+}
+
+// NetworkInterface connects the machine to a network
+type NetworkInterface struct {
+	// Name of the network interface
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// A human-friendly description.
+	// +optional
+	Description string `json:"description,omitempty"`
+
+	// The id of the network to connect to
+	// +optional
+	NetworkID string `json:"networkId,omitempty"`
+
+	// Constraint tags that select the network when networkId is empty. All
+	// mandatory constraints must match the tags of the network, the other
+	// ones choose between networks that match.
+	// +optional
+	Constraints []Constraint `json:"constraints,omitempty"`
+
+	// Static IP address to assign, it is allocated by vRA when empty
+	// +optional
+	Address string `json:"address,omitempty"`
+
+	// The ids of the security groups to apply
+	// +optional
+	SecurityGroupIDs []string `json:"securityGroupIds,omitempty"`
+
+	// The device index of the network interface
+	// +optional
+	DeviceIndex int32 `json:"deviceIndex,omitempty"`
+
+	// Additional properties that may be used to extend the network interface.
+	// +optional
+	CustomProperties map[string]string `json:"customProperties,omitempty"`
+}
+
+// NetworkInterfaceStatus is a network interface as last seen in vRA
+type NetworkInterfaceStatus struct {
+	// The id of the network interface in vRA
+	ID string `json:"id"`
+
+	// Name of the network interface
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// The device index of the network interface
+	// +optional
+	DeviceIndex int32 `json:"deviceIndex,omitempty"`
+
+	// Addresses assigned to the network interface
+	// +optional
+	Addresses []string `json:"addresses,omitempty"`
+}
+
+// DiskStatus is the state of a disk in the spec, or of one being removed
+type DiskStatus struct {
+	// Name of the disk in the spec
+	Name string `json:"name"`
+
+	// ID of the block device in vRA
+	// +optional
+	ID string `json:"id,omitempty"`
+
+	// Capacity of the disk in GB as last seen in vRA
+	// +optional
+	CapacityInGB int32 `json:"capacityInGB,omitempty"`
+
+	// Persistent is whether the disk outlives the machine
+	// +optional
+	Persistent bool `json:"persistent,omitempty"`
+
+	// State of the disk
+	// +optional
+	State DiskState `json:"state,omitempty"`
+}
+
+// VirtualMachineStatus defines the observed state of VirtualMachine
+type VirtualMachineStatus struct {
+	// +optional
+	Phase StatusPhase `json:"phase,omitempty"`
+	// +optional
+	LastMessage string `json:"lastMessage,omitempty"`
+	// ExternalRequestID is the vRA request being tracked
+	// +optional
+	ExternalRequestID string `json:"externalRequestID,omitempty"`
+	// Operation is what the tracked request does
+	// +optional
+	Operation Operation `json:"operation,omitempty"`
+	// RequestedFlavor is the flavor the tracked resize moves the machine to
+	// +optional
+	RequestedFlavor string `json:"requestedFlavor,omitempty"`
+	// RequestSubmittedAt is when the tracked request was submitted
+	// +optional
+	RequestSubmittedAt *metav1.Time `json:"requestSubmittedAt,omitempty"`
+	// RequestProgress is the percentage of the last tracked request that is
+	// done
+	// +optional
+	RequestProgress int32 `json:"requestProgress,omitempty"`
+	// RequestResources are the links to the resources of the last tracked
+	// request
+	// +optional
+	RequestResources []string `json:"requestResources,omitempty"`
+	// ExternalID is the id of the machine in vRA
+	// +optional
+	ExternalID string `json:"externalID,omitempty"`
+
+	// Machine is the state of the machine as last seen in vRA
+	// +optional
+	Machine *MachineStatus `json:"machine,omitempty"`
+
+	// PrivateKeySecretName is the Secret holding the private key generated
+	// for GeneratedKeyPair authentication
+	// +optional
+	PrivateKeySecretName string `json:"privateKeySecretName,omitempty"`
+
+	// ManagedTagKeys are the keys of the tags the controller set on the
+	// machine, tags with other keys are left alone
+	// +optional
+	ManagedTagKeys []string `json:"managedTagKeys,omitempty"`
+
+	// Disks are the disks created for the spec
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Disks []DiskStatus `json:"disks,omitempty"`
+
+	// Conditions describe the state of the machine, see the condition type
+	// constants
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// ObservedGeneration is the generation last acted on by the controller
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:storageversion
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Flavor",type=string,JSONPath=`.status.machine.flavor`,priority=1
+// +kubebuilder:printcolumn:name="Power",type=string,JSONPath=`.status.machine.powerState`
+// +kubebuilder:printcolumn:name="Address",type=string,JSONPath=`.status.machine.address`
+// +kubebuilder:printcolumn:name="External_ID",type=string,JSONPath=`.status.externalID`
+// +kubebuilder:printcolumn:name="Last_Message",type=string,JSONPath=`.status.lastMessage`,priority=1
+
+// VirtualMachine is the Schema for the virtualmachines API
+type VirtualMachine struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   VirtualMachineSpec   `json:"spec,omitempty"`
+	Status VirtualMachineStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// VirtualMachineList contains a list of VirtualMachine
+type VirtualMachineList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []VirtualMachine `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&VirtualMachine{}, &VirtualMachineList{})
+}
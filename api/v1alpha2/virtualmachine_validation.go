@@ -0,0 +1,111 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// ReservedTagPrefix is the prefix of the tags the controller sets on the
+// machines it creates to find them again
+const ReservedTagPrefix = "k8s_"
+
+// ValidateSpec returns the spec fields that cannot be honored when the
+// machine is created. The image is not needed to adopt a machine.
+func (r *VirtualMachine) ValidateSpec() field.ErrorList {
+	var errs field.ErrorList
+	spec := field.NewPath("spec")
+
+	switch {
+	case r.Spec.Image == "" && r.Spec.ImageRef == "" && r.Spec.AdoptMachineID == "":
+		errs = append(errs, field.Required(spec.Child("image"), "one of image and imageRef is required"))
+	case r.Spec.Image != "" && r.Spec.ImageRef != "":
+		errs = append(errs, field.Invalid(spec.Child("imageRef"), r.Spec.ImageRef, "image and imageRef are mutually exclusive"))
+	}
+
+	errs = append(errs, validateConstraints(spec.Child("constraints"), r.Spec.Constraints)...)
+	errs = append(errs, validateConstraints(spec.Child("imageDiskConstraints"), r.Spec.ImageDiskConstraints)...)
+	for i, tag := range r.Spec.Tags {
+		if strings.HasPrefix(tag.Key, ReservedTagPrefix) {
+			errs = append(errs, field.Invalid(spec.Child("tags").Index(i).Child("key"), tag.Key, "tags starting with "+ReservedTagPrefix+" are set by the controller"))
+		}
+	}
+	for i, disk := range r.Spec.Disks {
+		errs = append(errs, validateConstraints(spec.Child("disks").Index(i).Child("constraints"), disk.Constraints)...)
+	}
+
+	deviceIndexes := map[int32]bool{}
+	for i, nic := range r.Spec.NetworkInterfaces {
+		path := spec.Child("networkInterfaces").Index(i)
+		if nic.NetworkID == "" && len(nic.Constraints) == 0 {
+			errs = append(errs, field.Required(path.Child("networkId"), "one of networkId and constraints is required"))
+		}
+		errs = append(errs, validateConstraints(path.Child("constraints"), nic.Constraints)...)
+		if deviceIndexes[nic.DeviceIndex] {
+			errs = append(errs, field.Duplicate(path.Child("deviceIndex"), nic.DeviceIndex))
+		}
+		deviceIndexes[nic.DeviceIndex] = true
+	}
+
+	if bootConfig := r.Spec.BootConfig; bootConfig != nil {
+		sources := 0
+		for _, set := range []bool{bootConfig.Content != "", bootConfig.ConfigMapKeyRef != nil, bootConfig.SecretKeyRef != nil} {
+			if set {
+				sources++
+			}
+		}
+		switch {
+		case sources == 0:
+			errs = append(errs, field.Required(spec.Child("bootConfig"), "one of content, configMapKeyRef and secretKeyRef is required"))
+		case sources > 1:
+			errs = append(errs, field.Forbidden(spec.Child("bootConfig"), "content, configMapKeyRef and secretKeyRef are mutually exclusive"))
+		}
+	}
+	if remoteAccess := r.Spec.RemoteAccess; remoteAccess != nil {
+		path := spec.Child("remoteAccess")
+		if remoteAccess.Authentication == PublicKeyAuthentication {
+			if remoteAccess.PublicKeySecretRef == nil {
+				errs = append(errs, field.Required(path.Child("publicKeySecretRef"), "required for PublicKey authentication"))
+			}
+		} else if remoteAccess.PublicKeySecretRef != nil {
+			errs = append(errs, field.Forbidden(path.Child("publicKeySecretRef"), "only used for PublicKey authentication"))
+		}
+		if remoteAccess.Authentication == UsernamePasswordAuthentication {
+			if remoteAccess.CredentialsSecretRef == nil {
+				errs = append(errs, field.Required(path.Child("credentialsSecretRef"), "required for UsernamePassword authentication"))
+			}
+			if remoteAccess.Username != "" {
+				errs = append(errs, field.Forbidden(path.Child("username"), "read from credentialsSecretRef for UsernamePassword authentication"))
+			}
+		} else if remoteAccess.CredentialsSecretRef != nil {
+			errs = append(errs, field.Forbidden(path.Child("credentialsSecretRef"), "only used for UsernamePassword authentication"))
+		}
+	}
+	return errs
+}
+
+func validateConstraints(path *field.Path, constraints []Constraint) field.ErrorList {
+	var errs field.ErrorList
+	for i, constraint := range constraints {
+		if strings.TrimSpace(constraint.Expression) == "" {
+			errs = append(errs, field.Required(path.Index(i).Child("expression"), "constraint expression is empty"))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,48 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidateSpec(t *testing.T) {
+	tests := []struct {
+		name       string
+		spec       VirtualMachineSpec
+		wantFields []string
+	}{
+		{"image", VirtualMachineSpec{Image: "ubuntu"}, nil},
+		{"image ref", VirtualMachineSpec{ImageRef: "https://images/ubuntu"}, nil},
+		{"no image", VirtualMachineSpec{}, []string{"spec.image"}},
+		{"image and image ref", VirtualMachineSpec{Image: "ubuntu", ImageRef: "https://images/ubuntu"}, []string{"spec.imageRef"}},
+		{"adopted without image", VirtualMachineSpec{AdoptMachineID: "machine-1"}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			virtualMachine := &VirtualMachine{Spec: test.spec}
+			var fields []string
+			for _, err := range virtualMachine.ValidateSpec() {
+				fields = append(fields, err.Field)
+			}
+			if !reflect.DeepEqual(fields, test.wantFields) {
+				t.Errorf("ValidateSpec() fields = %v, want %v", fields, test.wantFields)
+			}
+		})
+	}
+}
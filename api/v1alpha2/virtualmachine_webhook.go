@@ -0,0 +1,73 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// SetupWebhookWithManager registers the VirtualMachine webhooks, which
+// serve the conversion between API versions, reject invalid specs and refuse
+// the deletion of protected VirtualMachines
+func (r *VirtualMachine) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/validate-machine-cmbu-local-v1alpha2-virtualmachine,mutating=false,failurePolicy=fail,sideEffects=None,groups=machine.cmbu.local,resources=virtualmachines,verbs=create;update;delete,versions=v1alpha2,name=vvirtualmachine.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &VirtualMachine{}
+
+// ValidateCreate rejects a VirtualMachine with an invalid spec
+func (r *VirtualMachine) ValidateCreate() error {
+	return r.validate()
+}
+
+// ValidateUpdate rejects a change leaving the spec invalid. Updates that keep
+// the spec, like the ones of the finalizer, are not checked so that objects
+// stored before the webhook ran can still be managed and deleted.
+func (r *VirtualMachine) ValidateUpdate(old runtime.Object) error {
+	if oldVirtualMachine, ok := old.(*VirtualMachine); ok && equality.Semantic.DeepEqual(oldVirtualMachine.Spec, r.Spec) {
+		return nil
+	}
+	if r.DeletionTimestamp != nil {
+		return nil
+	}
+	return r.validate()
+}
+
+// ValidateDelete refuses the deletion while deletion protection is on
+func (r *VirtualMachine) ValidateDelete() error {
+	if r.Spec.DeletionProtection {
+		return fmt.Errorf("VirtualMachine %s/%s has deletion protection, set spec.deletionProtection to false before deleting it", r.Namespace, r.Name)
+	}
+	return nil
+}
+
+func (r *VirtualMachine) validate() error {
+	if errs := r.ValidateSpec(); len(errs) > 0 {
+		return apierrors.NewInvalid(GroupVersion.WithKind("VirtualMachine").GroupKind(), r.Name, errs)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestValidateSpecOnAdmission(t *testing.T) {
+	valid := &VirtualMachine{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec:       VirtualMachineSpec{ProjectID: "project", Flavor: "small", Image: "ubuntu"},
+	}
+	invalid := valid.DeepCopy()
+	invalid.Spec.Image = ""
+	deleting := invalid.DeepCopy()
+	now := metav1.Now()
+	deleting.DeletionTimestamp = &now
+	finalized := invalid.DeepCopy()
+	finalized.Finalizers = []string{"virtualmachine.machine.cmbu.local/finalizer"}
+
+	tests := []struct {
+		name        string
+		validate    func() error
+		wantInvalid bool
+	}{
+		{"create valid", valid.ValidateCreate, false},
+		{"create invalid", invalid.ValidateCreate, true},
+		{"update valid", func() error { return valid.ValidateUpdate(invalid) }, false},
+		{"update invalid", func() error { return invalid.ValidateUpdate(valid) }, true},
+		{"update invalid while deleting", func() error { return deleting.ValidateUpdate(valid) }, false},
+		{"update keeping an invalid spec", func() error { return finalized.ValidateUpdate(invalid) }, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.validate()
+			if got := apierrors.IsInvalid(err); got != test.wantInvalid || (err != nil && !got) {
+				t.Errorf("got error %v, want invalid %t", err, test.wantInvalid)
+			}
+		})
+	}
+}
+
+func TestValidateDelete(t *testing.T) {
+	tests := []struct {
+		protected bool
+		wantErr   bool
+	}{
+		{false, false},
+		{true, true},
+	}
+	for _, test := range tests {
+		virtualMachine := &VirtualMachine{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+			Spec:       VirtualMachineSpec{DeletionProtection: test.protected},
+		}
+		if err := virtualMachine.ValidateDelete(); (err != nil) != test.wantErr {
+			t.Errorf("ValidateDelete() with deletion protection %t = %v, want error %t", test.protected, err, test.wantErr)
+		}
+	}
+}
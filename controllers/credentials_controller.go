@@ -0,0 +1,135 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	machinev1alpha1 "github.com/sammcgeown/vra/api/v1alpha1"
+	"github.com/sammcgeown/vra/pkg/vra"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const credentialsRetry = time.Minute
+
+// CredentialsReconciler watches the Secret holding the vRA refresh token, or
+// password, and rebuilds the default vRA client whenever it changes.
+type CredentialsReconciler struct {
+	client.Client
+	Log      logr.Logger
+	Recorder record.EventRecorder
+	Clients  *VRAClientCache
+
+	// Config is used to build the client, its RefreshToken or Password is
+	// taken from the Secret selected by SecretRef
+	Config    vra.Config
+	SecretRef machinev1alpha1.SecretKeyReference
+
+	// TLS settings, the objects they refer to are watched as well
+	TLS *machinev1alpha1.TLSConfig
+}
+
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
+// Reconcile rebuilds the default vRA client from the referenced Secret. Any
+// of the watched objects changing leads to the same request.
+func (r *CredentialsReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("secret", req.NamespacedName)
+
+	var secret corev1.Secret
+	if err := r.Get(ctx, req.NamespacedName, &secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			log.Info("vRA credentials secret not found")
+			r.Clients.Invalidate(DefaultVRAClient, fmt.Errorf("vRA credentials secret %s not found", req.NamespacedName))
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	credential, ok := secret.Data[r.SecretRef.Key]
+	if !ok || len(credential) == 0 {
+		err := fmt.Errorf("vRA credentials secret %s has no key %q", req.NamespacedName, r.SecretRef.Key)
+		r.Clients.Invalidate(DefaultVRAClient, err)
+		r.Recorder.Event(&secret, corev1.EventTypeWarning, "InvalidCredentials", err.Error())
+		return ctrl.Result{}, nil
+	}
+
+	cfg := r.Config
+	setCredential(&cfg, string(credential))
+	if err := ApplyTLSConfig(ctx, r, r.TLS, &cfg); err != nil {
+		r.Clients.Invalidate(DefaultVRAClient, err)
+		r.Recorder.Event(&secret, corev1.EventTypeWarning, "InvalidTLSConfig", err.Error())
+		return ctrl.Result{RequeueAfter: credentialsRetry}, nil
+	}
+	rebuilt, err := r.Clients.Update(DefaultVRAClient, cfg)
+	if err != nil {
+		log.Error(err, "unable to log in to vRealize Automation")
+		r.Recorder.Eventf(&secret, corev1.EventTypeWarning, "InvalidCredentials", "unable to log in to vRealize Automation: %v", err)
+		return ctrl.Result{RequeueAfter: credentialsRetry}, nil
+	}
+	if rebuilt {
+		log.Info("vRA client rebuilt from credentials secret")
+		r.Recorder.Event(&secret, corev1.EventTypeNormal, "CredentialsUpdated", "vRealize Automation client rebuilt")
+	}
+	return ctrl.Result{}, nil
+}
+
+// setCredential stores the secret credential in the field used by the
+// configured AuthMode
+func setCredential(cfg *vra.Config, credential string) {
+	if cfg.AuthMode == vra.PasswordAuth {
+		cfg.Password = credential
+	} else {
+		cfg.RefreshToken = credential
+	}
+}
+
+// SetupWithManager sets up the controller with the Manager, only the
+// referenced Secret, and the objects the TLS settings refer to, are watched.
+func (r *CredentialsReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	ref := types.NamespacedName{Name: r.SecretRef.Name, Namespace: r.SecretRef.Namespace}
+	toCredentials := handler.EnqueueRequestsFromMapFunc(func(client.Object) []reconcile.Request {
+		return []reconcile.Request{{NamespacedName: ref}}
+	})
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("credentials").
+		For(&corev1.Secret{}, builder.WithPredicates(predicate.NewPredicateFuncs(func(object client.Object) bool {
+			return object.GetName() == ref.Name && object.GetNamespace() == ref.Namespace
+		}))).
+		Watches(&source.Kind{Type: &corev1.Secret{}}, toCredentials, builder.WithPredicates(predicate.NewPredicateFuncs(func(object client.Object) bool {
+			return tlsReferences(r.TLS, "Secret", object)
+		}))).
+		Watches(&source.Kind{Type: &corev1.ConfigMap{}}, toCredentials, builder.WithPredicates(predicate.NewPredicateFuncs(func(object client.Object) bool {
+			return tlsReferences(r.TLS, "ConfigMap", object)
+		}))).
+		Complete(r)
+}
@@ -0,0 +1,589 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"path"
+	"sync"
+
+	"github.com/vmware/vra-sdk-go/pkg/models"
+)
+
+// fakeRequest is a vRA request held by fakeVRAClient until the test
+// finishes or fails it
+type fakeRequest struct {
+	tracker *models.RequestTracker
+	// complete applies the outcome of the request once it has finished
+	complete func(tracker *models.RequestTracker)
+}
+
+// fakeVRAClient is an in-memory VRAClient. Requests stay in progress until
+// Finish or Fail is called, so tests can step through each phase.
+type fakeVRAClient struct {
+	mu       sync.Mutex
+	nextID   int
+	machines map[string]*models.Machine
+	// specs are the specifications the machines were created with
+	specs    map[string]models.MachineSpecification
+	requests map[string]*fakeRequest
+	disks    map[string]*models.BlockDevice
+	// attached maps the ID of a block device to the machine it is attached to
+	attached map[string]string
+	networks []*models.Network
+	nics     map[string]*models.NetworkInterface
+	// updates counts the calls to UpdateMachine
+	updates int
+	// UpdateErr, when set, is returned by UpdateMachine
+	UpdateErr error
+
+	// Err, when set, is returned by every call
+	Err error
+}
+
+var _ VRAClient = &fakeVRAClient{}
+
+func newFakeVRAClient() *fakeVRAClient {
+	return &fakeVRAClient{
+		machines: map[string]*models.Machine{},
+		specs:    map[string]models.MachineSpecification{},
+		requests: map[string]*fakeRequest{},
+		disks:    map[string]*models.BlockDevice{},
+		attached: map[string]string{},
+		nics:     map[string]*models.NetworkInterface{},
+	}
+}
+
+func (f *fakeVRAClient) GetMachines(tags map[string]string) ([]*models.Machine, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+
+	var machines []*models.Machine
+	for _, machine := range f.machines {
+		if hasTags(machine.Tags, tags) {
+			copied := *machine
+			machines = append(machines, &copied)
+		}
+	}
+	return machines, nil
+}
+
+func (f *fakeVRAClient) GetMachine(id string) (*models.Machine, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+
+	machine, ok := f.machines[id]
+	if !ok {
+		return nil, nil
+	}
+	copied := *machine
+	return &copied, nil
+}
+
+func (f *fakeVRAClient) CreateMachine(spec *models.MachineSpecification) (*models.RequestTracker, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+
+	id := f.newID("machine")
+	machine := &models.Machine{
+		ID:               &id,
+		Name:             *spec.Name,
+		PowerState:       strPtr(models.MachinePowerStateON),
+		ProjectID:        *spec.ProjectID,
+		Tags:             spec.Tags,
+		CustomProperties: map[string]string{"flavor": *spec.Flavor},
+	}
+	for _, disk := range spec.Disks {
+		if _, ok := f.disks[*disk.BlockDeviceID]; !ok {
+			return nil, fmt.Errorf("block device %s not found", *disk.BlockDeviceID)
+		}
+	}
+	var nicLinks []string
+	for i, spec := range spec.Nics {
+		nicID := f.newID("nic")
+		addresses := spec.Addresses
+		if len(addresses) == 0 {
+			addresses = []string{fmt.Sprintf("10.0.%d.%d", i, f.nextID%250+1)}
+		}
+		f.nics[nicID] = &models.NetworkInterface{
+			ID:          &nicID,
+			Name:        spec.Name,
+			DeviceIndex: spec.DeviceIndex,
+			Addresses:   addresses,
+			CustomProperties: map[string]string{
+				"networkId": *spec.NetworkID,
+			},
+		}
+		nicLinks = append(nicLinks, "/iaas/api/machines/"+id+"/network-interfaces/"+nicID)
+	}
+	if len(nicLinks) > 0 {
+		machine.Links = map[string]models.Href{"network-interfaces": {Hrefs: nicLinks}}
+		machine.Address = f.nics[path.Base(nicLinks[0])].Addresses[0]
+	}
+	return f.newRequest("Provisioning", func(tracker *models.RequestTracker) {
+		f.machines[id] = machine
+		f.specs[id] = *spec
+		for _, disk := range spec.Disks {
+			f.attached[*disk.BlockDeviceID] = id
+		}
+		tracker.Resources = []string{"/iaas/api/machines/" + id}
+	}), nil
+}
+
+func (f *fakeVRAClient) DeleteMachine(id string) (*models.RequestTracker, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+
+	if _, ok := f.machines[id]; !ok {
+		return nil, nil
+	}
+	return f.newRequest("Remove Machine", func(*models.RequestTracker) {
+		delete(f.machines, id)
+		delete(f.specs, id)
+		for diskID, machineID := range f.attached {
+			if machineID == id {
+				delete(f.attached, diskID)
+				if !f.disks[diskID].Persistent {
+					delete(f.disks, diskID)
+				}
+			}
+		}
+	}), nil
+}
+
+func (f *fakeVRAClient) UpdateMachine(id string, spec *models.UpdateMachineSpecification) (*models.Machine, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	if f.UpdateErr != nil {
+		return nil, f.UpdateErr
+	}
+
+	machine, ok := f.machines[id]
+	if !ok {
+		return nil, fmt.Errorf("machine %s not found", id)
+	}
+	f.updates++
+	machine.Tags = spec.Tags
+	copied := *machine
+	return &copied, nil
+}
+
+func (f *fakeVRAClient) PowerOnMachine(id string) (*models.RequestTracker, error) {
+	return f.setPowerState(id, "Power On", models.MachinePowerStateON)
+}
+
+func (f *fakeVRAClient) PowerOffMachine(id string) (*models.RequestTracker, error) {
+	return f.setPowerState(id, "Power Off", models.MachinePowerStateOFF)
+}
+
+func (f *fakeVRAClient) ShutdownMachine(id string) (*models.RequestTracker, error) {
+	return f.setPowerState(id, "Shutdown", models.MachinePowerStateOFF)
+}
+
+func (f *fakeVRAClient) SuspendMachine(id string) (*models.RequestTracker, error) {
+	return f.setPowerState(id, "Suspend", models.MachinePowerStateSUSPEND)
+}
+
+// setPowerState starts a request that leaves the machine in powerState
+func (f *fakeVRAClient) setPowerState(id, name, powerState string) (*models.RequestTracker, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+
+	machine, ok := f.machines[id]
+	if !ok {
+		return nil, fmt.Errorf("machine %s not found", id)
+	}
+	return f.newRequest(name, func(*models.RequestTracker) {
+		machine.PowerState = strPtr(powerState)
+	}), nil
+}
+
+func (f *fakeVRAClient) ResizeMachine(id, flavor string) (*models.RequestTracker, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+
+	machine, ok := f.machines[id]
+	if !ok {
+		return nil, fmt.Errorf("machine %s not found", id)
+	}
+	return f.newRequest("Resize", func(*models.RequestTracker) {
+		machine.CustomProperties["flavor"] = flavor
+	}), nil
+}
+
+func (f *fakeVRAClient) GetMachineDisks(machineID string) ([]*models.BlockDevice, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+
+	if _, ok := f.machines[machineID]; !ok {
+		return nil, fmt.Errorf("machine %s not found", machineID)
+	}
+	var disks []*models.BlockDevice
+	for diskID, attachedTo := range f.attached {
+		if attachedTo == machineID {
+			disk := *f.disks[diskID]
+			disks = append(disks, &disk)
+		}
+	}
+	return disks, nil
+}
+
+func (f *fakeVRAClient) CreateBlockDevice(spec *models.BlockDeviceSpecification) (*models.RequestTracker, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+
+	id := f.newID("disk")
+	disk := &models.BlockDevice{
+		ID:           &id,
+		Name:         *spec.Name,
+		CapacityInGB: spec.CapacityInGB,
+		Persistent:   spec.Persistent,
+		Status:       strPtr(models.BlockDeviceStatusAVAILABLE),
+		Tags:         spec.Tags,
+	}
+	return f.newRequest("Create Disk", func(tracker *models.RequestTracker) {
+		f.disks[id] = disk
+		tracker.Resources = []string{"/iaas/api/block-devices/" + id}
+	}), nil
+}
+
+func (f *fakeVRAClient) AttachMachineDisk(machineID, blockDeviceID, name string) (*models.RequestTracker, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+
+	if _, ok := f.disks[blockDeviceID]; !ok {
+		return nil, fmt.Errorf("block device %s not found", blockDeviceID)
+	}
+	return f.newRequest("Attach Disk", func(*models.RequestTracker) {
+		f.attached[blockDeviceID] = machineID
+	}), nil
+}
+
+func (f *fakeVRAClient) DetachMachineDisk(machineID, blockDeviceID string) (*models.RequestTracker, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+
+	if f.attached[blockDeviceID] != machineID {
+		return nil, fmt.Errorf("block device %s is not attached to machine %s", blockDeviceID, machineID)
+	}
+	return f.newRequest("Detach Disk", func(*models.RequestTracker) {
+		delete(f.attached, blockDeviceID)
+	}), nil
+}
+
+func (f *fakeVRAClient) ResizeBlockDevice(id string, capacityInGB int32) (*models.RequestTracker, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+
+	disk, ok := f.disks[id]
+	if !ok {
+		return nil, fmt.Errorf("block device %s not found", id)
+	}
+	return f.newRequest("Resize Disk", func(*models.RequestTracker) {
+		disk.CapacityInGB = &capacityInGB
+	}), nil
+}
+
+func (f *fakeVRAClient) DeleteBlockDevice(id string) (*models.RequestTracker, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+
+	if _, ok := f.disks[id]; !ok {
+		return nil, fmt.Errorf("block device %s not found", id)
+	}
+	return f.newRequest("Delete Disk", func(*models.RequestTracker) {
+		delete(f.disks, id)
+	}), nil
+}
+
+func (f *fakeVRAClient) GetNetworks(projectID string) ([]*models.Network, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	var networks []*models.Network
+	for _, network := range f.networks {
+		if network.ProjectID == projectID {
+			networks = append(networks, network)
+		}
+	}
+	return networks, nil
+}
+
+func (f *fakeVRAClient) GetMachineNetworkInterface(machineID, id string) (*models.NetworkInterface, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+
+	nic, ok := f.nics[id]
+	if !ok {
+		return nil, fmt.Errorf("network interface %s not found", id)
+	}
+	copied := *nic
+	return &copied, nil
+}
+
+// AddNetwork adds a network with id of project projectID carrying tags
+func (f *fakeVRAClient) AddNetwork(id, projectID string, tags map[string]string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	network := &models.Network{ID: &id, Name: id, ProjectID: projectID}
+	for key, value := range tags {
+		key, value := key, value
+		network.Tags = append(network.Tags, &models.Tag{Key: &key, Value: &value})
+	}
+	f.networks = append(f.networks, network)
+}
+
+// NetworkOf returns the id of the network the network interface with id is
+// connected to
+func (f *fakeVRAClient) NetworkOf(id string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if nic, ok := f.nics[id]; ok {
+		return nic.CustomProperties["networkId"]
+	}
+	return ""
+}
+
+// BlockDevices returns the number of block devices held by the fake
+func (f *fakeVRAClient) BlockDevices() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.disks)
+}
+
+// DiskTags returns the tags of the block device with id as key:value
+func (f *fakeVRAClient) DiskTags(id string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var tags []string
+	if disk, ok := f.disks[id]; ok {
+		for _, tag := range disk.Tags {
+			tags = append(tags, *tag.Key+":"+*tag.Value)
+		}
+	}
+	return tags
+}
+
+// Flavor returns the flavor of the machine with id
+func (f *fakeVRAClient) Flavor(id string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if machine, ok := f.machines[id]; ok {
+		return machine.CustomProperties["flavor"]
+	}
+	return ""
+}
+
+// Specification returns the specification the machine with id was created
+// with
+func (f *fakeVRAClient) Specification(id string) models.MachineSpecification {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.specs[id]
+}
+
+// Tags returns the tags of the machine with id as key:value strings
+func (f *fakeVRAClient) Tags(id string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var tags []string
+	if machine, ok := f.machines[id]; ok {
+		for _, tag := range machine.Tags {
+			tags = append(tags, *tag.Key+":"+*tag.Value)
+		}
+	}
+	return tags
+}
+
+// SetTags replaces the tags of the machine with id, as a change made in vRA
+func (f *fakeVRAClient) SetTags(id string, tags map[string]string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	machine := f.machines[id]
+	machine.Tags = nil
+	for key, value := range tags {
+		key, value := key, value
+		machine.Tags = append(machine.Tags, &models.Tag{Key: &key, Value: &value})
+	}
+}
+
+// AddMachine adds a machine with tags to a project, as one created outside
+// the controller, and returns its ID
+func (f *fakeVRAClient) AddMachine(name, projectID string, tags map[string]string) string {
+	f.mu.Lock()
+	id := f.newID("machine")
+	f.machines[id] = &models.Machine{
+		ID:               &id,
+		Name:             name,
+		PowerState:       strPtr(models.MachinePowerStateON),
+		ProjectID:        projectID,
+		CustomProperties: map[string]string{"flavor": "small"},
+	}
+	f.mu.Unlock()
+	f.SetTags(id, tags)
+	return id
+}
+
+// SetErr sets Err while the controller may be calling the fake
+func (f *fakeVRAClient) SetErr(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.Err = err
+}
+
+// SetUpdateErr sets UpdateErr while the controller may be calling the fake
+func (f *fakeVRAClient) SetUpdateErr(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.UpdateErr = err
+}
+
+// Updates returns the number of UpdateMachine calls
+func (f *fakeVRAClient) Updates() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.updates
+}
+
+// PowerState returns the power state of the machine with id
+func (f *fakeVRAClient) PowerState(id string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if machine, ok := f.machines[id]; ok {
+		return *machine.PowerState
+	}
+	return ""
+}
+
+func (f *fakeVRAClient) GetRequestTracker(id string) (*models.RequestTracker, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+
+	request, ok := f.requests[id]
+	if !ok {
+		return nil, fmt.Errorf("request %s not found", id)
+	}
+	tracker := *request.tracker
+	return &tracker, nil
+}
+
+// Finish completes every request still in progress
+func (f *fakeVRAClient) Finish() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, request := range f.requests {
+		if *request.tracker.Status == models.RequestTrackerStatusINPROGRESS {
+			request.complete(request.tracker)
+			request.tracker.Status = strPtr(models.RequestTrackerStatusFINISHED)
+			request.tracker.Progress = int32Ptr(100)
+		}
+	}
+}
+
+// Fail fails every request still in progress with message
+func (f *fakeVRAClient) Fail(message string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, request := range f.requests {
+		if *request.tracker.Status == models.RequestTrackerStatusINPROGRESS {
+			request.tracker.Status = strPtr(models.RequestTrackerStatusFAILED)
+			request.tracker.Message = message
+		}
+	}
+}
+
+// Machines returns the number of machines held by the fake
+func (f *fakeVRAClient) Machines() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.machines)
+}
+
+func (f *fakeVRAClient) newRequest(name string, complete func(*models.RequestTracker)) *models.RequestTracker {
+	id := f.newID("request")
+	tracker := &models.RequestTracker{
+		ID:       &id,
+		Name:     name,
+		Progress: int32Ptr(0),
+		SelfLink: strPtr("/iaas/api/request-tracker/" + id),
+		Status:   strPtr(models.RequestTrackerStatusINPROGRESS),
+	}
+	f.requests[id] = &fakeRequest{tracker: tracker, complete: complete}
+
+	copied := *tracker
+	return &copied
+}
+
+func (f *fakeVRAClient) newID(prefix string) string {
+	f.nextID++
+	return fmt.Sprintf("%s-%d", prefix, f.nextID)
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func int32Ptr(i int32) *int32 {
+	return &i
+}
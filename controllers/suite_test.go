@@ -17,13 +17,16 @@ limitations under the License.
 package controllers
 
 import (
+	"context"
 	"path/filepath"
 	"testing"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/envtest"
 	"sigs.k8s.io/controller-runtime/pkg/envtest/printer"
@@ -31,15 +34,27 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	machinev1alpha1 "github.com/sammcgeown/vra/api/v1alpha1"
+	machinev1alpha2 "github.com/sammcgeown/vra/api/v1alpha2"
+	"github.com/sammcgeown/vra/pkg/vra"
+	"github.com/sammcgeown/vra/pkg/vrasim"
 	//+kubebuilder:scaffold:imports
 )
 
+// simulatorEndpoint is the endpoint name that selects the vRA simulator
+const simulatorEndpoint = "vrasim"
+
+// testClusterID is the cluster ID the controller under test tags machines with
+const testClusterID = "test-cluster"
+
 // These tests use Ginkgo (BDD-style Go testing framework). Refer to
 // http://onsi.github.io/ginkgo/ to learn more about Ginkgo.
 
 var cfg *rest.Config
 var k8sClient client.Client
 var testEnv *envtest.Environment
+var fakeVRA *fakeVRAClient
+var vraSim *vrasim.Server
+var cancel context.CancelFunc
 
 func TestAPIs(t *testing.T) {
 	RegisterFailHandler(Fail)
@@ -58,23 +73,78 @@ var _ = BeforeSuite(func() {
 		ErrorIfCRDPathMissing: true,
 	}
 
-	cfg, err := testEnv.Start()
+	var err error
+	cfg, err = testEnv.Start()
 	Expect(err).NotTo(HaveOccurred())
 	Expect(cfg).NotTo(BeNil())
 
 	err = machinev1alpha1.AddToScheme(scheme.Scheme)
 	Expect(err).NotTo(HaveOccurred())
 
+	err = machinev1alpha2.AddToScheme(scheme.Scheme)
+	Expect(err).NotTo(HaveOccurred())
+
 	//+kubebuilder:scaffold:scheme
 
 	k8sClient, err = client.New(cfg, client.Options{Scheme: scheme.Scheme})
 	Expect(err).NotTo(HaveOccurred())
 	Expect(k8sClient).NotTo(BeNil())
 
+	By("starting the controllers against a fake vRA client")
+	mgr, err := ctrl.NewManager(cfg, ctrl.Options{
+		Scheme:             scheme.Scheme,
+		MetricsBindAddress: "0",
+	})
+	Expect(err).NotTo(HaveOccurred())
+
+	fakeVRA = newFakeVRAClient()
+	clients := NewVRAClientCache()
+	clients.Set(DefaultVRAClient, fakeVRA)
+
+	// Machines using the simulator endpoint go through the real SDK client
+	vraSim = vrasim.NewServer(vrasim.Options{
+		RefreshToken:    "refresh",
+		Latency:         10 * time.Millisecond,
+		RequestDuration: time.Second,
+	})
+	api, err := vra.NewClient(vra.Config{URL: vraSim.URL, RefreshToken: "refresh"})
+	Expect(err).NotTo(HaveOccurred())
+	clients.Set(EndpointVRAClient(simulatorEndpoint), NewVRAClient(api))
+
+	err = (&VirtualMachineReconciler{
+		Client:          mgr.GetClient(),
+		Scheme:          mgr.GetScheme(),
+		Clients:         clients,
+		Log:             ctrl.Log.WithName("controllers").WithName("VirtualMachine"),
+		Recorder:        mgr.GetEventRecorderFor("virtualmachine-controller"),
+		PollInterval:    100 * time.Millisecond,
+		MaxPollInterval: 500 * time.Millisecond,
+		RequestTimeouts: map[machinev1alpha2.Operation]time.Duration{
+			machinev1alpha2.CreateOperation: 3 * time.Second,
+			machinev1alpha2.DeleteOperation: 3 * time.Second,
+			machinev1alpha2.ResizeOperation: 3 * time.Second,
+		},
+		ResyncInterval: 500 * time.Millisecond,
+		ClusterID:      testClusterID,
+	}).SetupWithManager(mgr)
+	Expect(err).NotTo(HaveOccurred())
+
+	var ctx context.Context
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		defer GinkgoRecover()
+		Expect(mgr.Start(ctx)).To(Succeed())
+	}()
 }, 60)
 
 var _ = AfterSuite(func() {
 	By("tearing down the test environment")
+	if cancel != nil {
+		cancel()
+	}
+	if vraSim != nil {
+		vraSim.Close()
+	}
 	err := testEnv.Stop()
 	Expect(err).NotTo(HaveOccurred())
 })
@@ -0,0 +1,111 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+
+	"github.com/pkg/errors"
+	machinev1alpha1 "github.com/sammcgeown/vra/api/v1alpha1"
+	"github.com/sammcgeown/vra/pkg/vra"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ApplyTLSConfig resolves the references in tlsConfig and stores the
+// resulting settings in cfg
+func ApplyTLSConfig(ctx context.Context, c client.Reader, tlsConfig *machinev1alpha1.TLSConfig, cfg *vra.Config) error {
+	if tlsConfig == nil {
+		return nil
+	}
+
+	cfg.Insecure = tlsConfig.InsecureSkipVerify
+	cfg.CABundle = append([]byte{}, tlsConfig.CABundle...)
+	if tlsConfig.MinVersion != "" {
+		version, ok := tlsVersions[tlsConfig.MinVersion]
+		if !ok {
+			return fmt.Errorf("unsupported TLS version %q", tlsConfig.MinVersion)
+		}
+		cfg.MinTLSVersion = version
+	}
+
+	if ref := tlsConfig.CABundleRef; ref != nil {
+		key := types.NamespacedName{Name: ref.Name, Namespace: ref.Namespace}
+		var bundle []byte
+		switch ref.Kind {
+		case "ConfigMap":
+			var configMap corev1.ConfigMap
+			if err := c.Get(ctx, key, &configMap); err != nil {
+				return errors.Wrapf(err, "unable to read CA bundle configmap %s", key)
+			}
+			bundle = []byte(configMap.Data[ref.Key])
+		case "Secret":
+			var secret corev1.Secret
+			if err := c.Get(ctx, key, &secret); err != nil {
+				return errors.Wrapf(err, "unable to read CA bundle secret %s", key)
+			}
+			bundle = secret.Data[ref.Key]
+		default:
+			return fmt.Errorf("unsupported CA bundle kind %q", ref.Kind)
+		}
+		if len(bundle) == 0 {
+			return fmt.Errorf("CA bundle %s %s has no key %q", ref.Kind, key, ref.Key)
+		}
+		cfg.CABundle = append(append(cfg.CABundle, '\n'), bundle...)
+	}
+
+	if ref := tlsConfig.ClientCertificateSecretRef; ref != nil {
+		key := types.NamespacedName{Name: ref.Name, Namespace: ref.Namespace}
+		var secret corev1.Secret
+		if err := c.Get(ctx, key, &secret); err != nil {
+			return errors.Wrapf(err, "unable to read client certificate secret %s", key)
+		}
+		cfg.ClientCertificate = secret.Data[corev1.TLSCertKey]
+		cfg.ClientKey = secret.Data[corev1.TLSPrivateKeyKey]
+		if len(cfg.ClientCertificate) == 0 || len(cfg.ClientKey) == 0 {
+			return fmt.Errorf("client certificate secret %s needs both %s and %s", key, corev1.TLSCertKey, corev1.TLSPrivateKeyKey)
+		}
+	}
+	return nil
+}
+
+// tlsReferences reports whether tlsConfig refers to the object of the given
+// kind, so that changes to it can be picked up
+func tlsReferences(tlsConfig *machinev1alpha1.TLSConfig, kind string, object client.Object) bool {
+	if tlsConfig == nil {
+		return false
+	}
+	if ref := tlsConfig.CABundleRef; ref != nil && ref.Kind == kind &&
+		ref.Name == object.GetName() && ref.Namespace == object.GetNamespace() {
+		return true
+	}
+	if ref := tlsConfig.ClientCertificateSecretRef; ref != nil && kind == "Secret" &&
+		ref.Name == object.GetName() && ref.Namespace == object.GetNamespace() {
+		return true
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"text/template"
+
+	"github.com/pkg/errors"
+	machinev1alpha2 "github.com/sammcgeown/vra/api/v1alpha2"
+	"github.com/vmware/vra-sdk-go/pkg/models"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// bootConfigData is what the boot config template is executed with
+type bootConfigData struct {
+	Name      string
+	Namespace string
+	Labels    map[string]string
+}
+
+// bootConfig reads and renders the boot config of virtualMachine, it is nil
+// when there is none
+func (r *VirtualMachineReconciler) bootConfig(ctx context.Context, virtualMachine *machinev1alpha2.VirtualMachine) (*models.MachineBootConfig, error) {
+	spec := virtualMachine.Spec.BootConfig
+	if spec == nil {
+		return nil, nil
+	}
+
+	content, found, err := r.bootConfigContent(ctx, virtualMachine.Namespace, spec)
+	if err != nil || !found {
+		return nil, err
+	}
+	tmpl, err := template.New("bootConfig").Option("missingkey=zero").Parse(content)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid boot config template")
+	}
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, bootConfigData{
+		Name:      virtualMachine.Name,
+		Namespace: virtualMachine.Namespace,
+		Labels:    virtualMachine.Labels,
+	}); err != nil {
+		return nil, errors.Wrap(err, "unable to render boot config")
+	}
+	return &models.MachineBootConfig{Content: rendered.String()}, nil
+}
+
+// bootConfigContent returns the unrendered boot config from the source set in
+// spec, which has been validated to set only one. An optional ConfigMap or Secret that does not exist is not found.
+func (r *VirtualMachineReconciler) bootConfigContent(ctx context.Context, namespace string, spec *machinev1alpha2.BootConfig) (string, bool, error) {
+	switch {
+	case spec.ConfigMapKeyRef != nil:
+		ref := spec.ConfigMapKeyRef
+		var configMap corev1.ConfigMap
+		if err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: namespace}, &configMap); err != nil {
+			if apierrors.IsNotFound(err) && isOptional(ref.Optional) {
+				return "", false, nil
+			}
+			return "", false, errors.Wrapf(err, "unable to read boot config configmap %s/%s", namespace, ref.Name)
+		}
+		if content, ok := configMap.Data[ref.Key]; ok {
+			return content, true, nil
+		}
+		if content, ok := configMap.BinaryData[ref.Key]; ok {
+			return string(content), true, nil
+		}
+		if isOptional(ref.Optional) {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("boot config configmap %s/%s has no key %q", namespace, ref.Name, ref.Key)
+	case spec.SecretKeyRef != nil:
+		ref := spec.SecretKeyRef
+		var secret corev1.Secret
+		if err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: namespace}, &secret); err != nil {
+			if apierrors.IsNotFound(err) && isOptional(ref.Optional) {
+				return "", false, nil
+			}
+			return "", false, errors.Wrapf(err, "unable to read boot config secret %s/%s", namespace, ref.Name)
+		}
+		if content, ok := secret.Data[ref.Key]; ok {
+			return string(content), true, nil
+		}
+		if isOptional(ref.Optional) {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("boot config secret %s/%s has no key %q", namespace, ref.Name, ref.Key)
+	default:
+		return spec.Content, true, nil
+	}
+}
+
+func isOptional(optional *bool) bool {
+	return optional != nil && *optional
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	machinev1alpha2 "github.com/sammcgeown/vra/api/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// Keys of the connection secret
+const (
+	connectionAddressKey   = "address"
+	connectionHostnameKey  = "hostname"
+	connectionAddressesKey = "addresses"
+	connectionUsernameKey  = "username"
+	connectionPasswordKey  = "password"
+	connectionPortKey      = "port"
+
+	defaultRemoteAccessPort = 22
+)
+
+// publishConnectionDetails writes the connection details of the machine to
+// the Secret or ConfigMap named in spec.writeConnectionSecretToRef, creating
+// it owned by virtualMachine. A ConfigMap gets no credentials.
+func (r *VirtualMachineReconciler) publishConnectionDetails(ctx context.Context, virtualMachine *machinev1alpha2.VirtualMachine) error {
+	ref := virtualMachine.Spec.WriteConnectionSecretToRef
+	if ref == nil || virtualMachine.Status.Machine == nil {
+		return nil
+	}
+	kind := ref.Kind
+	if kind == "" {
+		kind = "Secret"
+	}
+	credentials := kind == "Secret"
+	if remoteAccess := virtualMachine.Spec.RemoteAccess; credentials && remoteAccess != nil &&
+		remoteAccess.Authentication == machinev1alpha2.UsernamePasswordAuthentication && remoteAccess.CredentialsSecretRef == nil {
+		// Adopted machines skip the spec validation, the secret is written
+		// once the reference is set
+		setCondition(virtualMachine, machinev1alpha2.ConnectionDetailsPublishedCondition, metav1.ConditionFalse,
+			machinev1alpha2.CredentialsSecretRefMissingReason, "spec.remoteAccess.credentialsSecretRef is required for UsernamePassword authentication")
+		return nil
+	}
+
+	data, err := r.connectionDetails(ctx, virtualMachine, credentials)
+	if err != nil {
+		return err
+	}
+	objectMeta := metav1.ObjectMeta{Name: ref.Name, Namespace: virtualMachine.Namespace}
+	var object client.Object = &corev1.Secret{ObjectMeta: objectMeta}
+	if !credentials {
+		object = &corev1.ConfigMap{ObjectMeta: objectMeta}
+	}
+	_, err = controllerutil.CreateOrUpdate(ctx, r.Client, object, func() error {
+		if object.GetResourceVersion() != "" && !metav1.IsControlledBy(object, virtualMachine) {
+			return fmt.Errorf("%s %s/%s already exists and is not owned by the VirtualMachine", kind, object.GetNamespace(), object.GetName())
+		}
+		switch object := object.(type) {
+		case *corev1.Secret:
+			object.Data = data
+		case *corev1.ConfigMap:
+			object.Data = map[string]string{}
+			for key, value := range data {
+				object.Data[key] = string(value)
+			}
+		}
+		return controllerutil.SetControllerReference(virtualMachine, object, r.Scheme)
+	})
+	if err != nil {
+		return errors.Wrapf(err, "unable to write connection %s %s/%s", kind, virtualMachine.Namespace, ref.Name)
+	}
+	setCondition(virtualMachine, machinev1alpha2.ConnectionDetailsPublishedCondition, metav1.ConditionTrue,
+		machinev1alpha2.ConnectionSecretWrittenReason, fmt.Sprintf("connection details written to %s %s", kind, ref.Name))
+	return nil
+}
+
+// connectionDetails returns the content of the connection secret, along with
+// the credentials of the remote access settings when credentials is set
+func (r *VirtualMachineReconciler) connectionDetails(ctx context.Context, virtualMachine *machinev1alpha2.VirtualMachine, credentials bool) (map[string][]byte, error) {
+	machine := virtualMachine.Status.Machine
+	var addresses []string
+	for _, nic := range machine.NetworkInterfaces {
+		addresses = append(addresses, nic.Addresses...)
+	}
+	data := map[string][]byte{
+		connectionAddressKey:   []byte(machine.Address),
+		connectionHostnameKey:  []byte(machine.Hostname),
+		connectionAddressesKey: []byte(strings.Join(addresses, ",")),
+	}
+
+	remoteAccess := virtualMachine.Spec.RemoteAccess
+	if remoteAccess == nil {
+		return data, nil
+	}
+	port := remoteAccess.Port
+	if port == 0 {
+		port = defaultRemoteAccessPort
+	}
+	data[connectionPortKey] = []byte(strconv.Itoa(int(port)))
+	if remoteAccess.Username != "" {
+		data[connectionUsernameKey] = []byte(remoteAccess.Username)
+	}
+
+	if !credentials {
+		return data, nil
+	}
+	switch remoteAccess.Authentication {
+	case machinev1alpha2.GeneratedKeyPairAuthentication:
+		if virtualMachine.Status.PrivateKeySecretName == "" {
+			break
+		}
+		var secret corev1.Secret
+		key := types.NamespacedName{Name: virtualMachine.Status.PrivateKeySecretName, Namespace: virtualMachine.Namespace}
+		if err := r.Get(ctx, key, &secret); err != nil {
+			return nil, errors.Wrapf(err, "unable to read private key secret %s", key)
+		}
+		data[corev1.SSHAuthPrivateKey] = secret.Data[corev1.SSHAuthPrivateKey]
+	case machinev1alpha2.UsernamePasswordAuthentication:
+		if remoteAccess.CredentialsSecretRef == nil {
+			break
+		}
+		secret, err := r.remoteAccessSecret(ctx, virtualMachine.Namespace, remoteAccess.CredentialsSecretRef.Name)
+		if err != nil {
+			return nil, err
+		}
+		data[connectionUsernameKey] = secret.Data[corev1.BasicAuthUsernameKey]
+		data[connectionPasswordKey] = secret.Data[corev1.BasicAuthPasswordKey]
+	}
+	return data, nil
+}
@@ -19,16 +19,19 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"path"
 	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
-	machinev1alpha1 "github.com/sammcgeown/vra/api/v1alpha1"
-	vraclient "github.com/vmware/vra-sdk-go/pkg/client"
-	"github.com/vmware/vra-sdk-go/pkg/client/compute"
-	"github.com/vmware/vra-sdk-go/pkg/client/request"
+	machinev1alpha2 "github.com/sammcgeown/vra/api/v1alpha2"
 	"github.com/vmware/vra-sdk-go/pkg/models"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -36,26 +39,58 @@ import (
 const (
 	virtualMachineFinalizer = "virtualmachine.machine.cmbu.local/finalizer"
 	defaultRequeue          = 20 * time.Second
+	defaultResync           = 5 * time.Minute
 )
 
 // VirtualMachineReconciler reconciles a VirtualMachine object
 type VirtualMachineReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
-	VRA    *vraclient.MulticloudIaaS
-	Log    logr.Logger
+	Scheme   *runtime.Scheme
+	Clients  *VRAClientCache
+	Log      logr.Logger
+	Recorder record.EventRecorder
+
+	// PollInterval is the first wait before a running vRA request is
+	// checked, it defaults to defaultRequeue. The wait doubles while the
+	// request runs, up to MaxPollInterval which defaults to
+	// defaultMaxPollInterval.
+	PollInterval    time.Duration
+	MaxPollInterval time.Duration
+	// RequestTimeouts override how long the requests of each operation may
+	// run, see defaultRequestTimeouts
+	RequestTimeouts map[machinev1alpha2.Operation]time.Duration
+	// ResyncInterval is how often a ready machine is compared with vRA to
+	// catch changes made there, it defaults to defaultResync
+	ResyncInterval time.Duration
+	// ClusterID is tagged on the machines of this cluster, machines tagged
+	// with another cluster ID are never looked up
+	ClusterID string
+	// DefaultDeletionPolicy applies to the VirtualMachines without a
+	// deletion policy, it defaults to Delete
+	DefaultDeletionPolicy machinev1alpha2.DeletionPolicy
 }
 
 //+kubebuilder:rbac:groups=machine.cmbu.local,resources=virtualmachines,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=machine.cmbu.local,resources=virtualmachines/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=machine.cmbu.local,resources=virtualmachines/finalizers,verbs=update
-
-// Reconcile is part of the main kubernetes reconciliation loop which aims to
-// move the current state of the cluster closer to the desired state.
-// TODO(user): Modify the Reconcile function to compare the state specified by
-// the VirtualMachine object against the actual cluster state, and then
-// perform operations to make the cluster state reflect the state specified by
-// the user.
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
+// Reconcile compares a VirtualMachine with its machine in vRA and takes the
+// next step towards the spec, recording the outcome in the status conditions.
+// At most one vRA request is tracked at a time, in this order:
+//   - a tracked request is checked and nothing else is done until it has
+//     finished, failed or timed out
+//   - a VirtualMachine being deleted has its machine deleted, or retained by
+//     its deletion policy, before the finalizer is removed
+//   - the machine is looked up by ID or by its ownership tags, or adopted,
+//     and when there is none its disks and then the machine are created
+//   - the observed machine is recorded, its tags re-applied and its
+//     connection details published
+//   - the power state, the flavor and the disks are brought in line with the
+//     spec, one operation per request
+//   - the machine is reported ready and checked again after ResyncInterval
 //
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.10.0/pkg/reconcile
@@ -63,10 +98,10 @@ func (r *VirtualMachineReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 	//_ = log.FromContext(ctx)
 	log := r.Log.WithValues("virtualmachine", req.NamespacedName)
 
-	var virtualMachine machinev1alpha1.VirtualMachine
+	var virtualMachine machinev1alpha2.VirtualMachine
 	if err := r.Get(ctx, req.NamespacedName, &virtualMachine); err != nil {
-		if err.Error() == "VirtualMachine.machine.cmbu.local \""+virtualMachine.Name+"\" not found" {
-			log.Info("unable to fetch VirtualMachine", err)
+		if apierrors.IsNotFound(err) {
+			log.Info("unable to fetch VirtualMachine", "error", err)
 			return ctrl.Result{}, nil
 		}
 		// else
@@ -78,69 +113,164 @@ func (r *VirtualMachineReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 	msg := fmt.Sprintf("received reconcile request for %q (namespace: %q)", virtualMachine.GetName(), virtualMachine.GetNamespace())
 	log.Info(msg)
 
+	clientName := DefaultVRAClient
+	if virtualMachine.Spec.EndpointName != "" {
+		clientName = EndpointVRAClient(virtualMachine.Spec.EndpointName)
+	}
+	vra, err := r.Clients.Get(clientName)
+	if err != nil {
+		setStatus(
+			&virtualMachine,
+			machinev1alpha2.ErrorStatusPhase,
+			"vRealize Automation client unavailable",
+			err,
+			virtualMachine.Status.ExternalRequestID,
+			virtualMachine.Status.ExternalID,
+		)
+		setCondition(&virtualMachine, machinev1alpha2.CredentialsValidCondition, metav1.ConditionFalse, machinev1alpha2.ClientUnavailableReason, err.Error())
+		setCondition(&virtualMachine, machinev1alpha2.ReadyCondition, metav1.ConditionFalse, machinev1alpha2.ClientUnavailableReason, err.Error())
+		return ctrl.Result{RequeueAfter: defaultRequeue}, r.updateStatus(ctx, &virtualMachine)
+	}
+	setCondition(&virtualMachine, machinev1alpha2.CredentialsValidCondition, metav1.ConditionTrue, machinev1alpha2.ClientAvailableReason, "vRealize Automation client is logged in")
+
+	if virtualMachine.Status.ExternalRequestID != "" && virtualMachine.Status.Operation == machinev1alpha2.CreateOperation &&
+		!virtualMachine.DeletionTimestamp.IsZero() && !virtualMachine.Spec.DeletionProtection && r.requestTimedOut(&virtualMachine) {
+		// Stop waiting for a create request that timed out, the deletion
+		// removes the machine if vRA created it after all
+		log.Info("forgetting timed out create request", "requestID", virtualMachine.Status.ExternalRequestID)
+		setStatus(&virtualMachine, machinev1alpha2.ErrorStatusPhase, "create request timed out", nil, "", virtualMachine.Status.ExternalID)
+		setCondition(&virtualMachine, machinev1alpha2.RequestInProgressCondition, metav1.ConditionFalse, machinev1alpha2.RequestTimedOutReason, "create request forgotten on deletion")
+	}
+
 	// Check if there is a RequestID for the VirtualMachine
 	if virtualMachine.Status.ExternalRequestID != "" {
 		// There is a request ID, check the status of the request
-		requestTracker, err := r.VRA.Request.GetRequestTracker(request.NewGetRequestTrackerParams().WithID(virtualMachine.Status.ExternalRequestID))
+		requestID := virtualMachine.Status.ExternalRequestID
+		requestTracker, err := vra.GetRequestTracker(requestID)
 		if err != nil {
 			//return "", models.RequestTrackerStatusFAILED, err
-			virtualMachine.Status = createStatus(
-				machinev1alpha1.ErrorStatusPhase,
+			setStatus(
+				&virtualMachine,
+				machinev1alpha2.ErrorStatusPhase,
 				"request tracker failed",
 				err,
-				virtualMachine.Status.ExternalRequestID,
-				"",
+				requestID,
+				virtualMachine.Status.ExternalID,
 			)
-			return ctrl.Result{}, errors.Wrap(r.Client.Status().Update(ctx, &virtualMachine), "could not update status")
+			setCondition(&virtualMachine, machinev1alpha2.SyncedCondition, metav1.ConditionFalse, machinev1alpha2.RequestTrackerErrorReason, err.Error())
+			return ctrl.Result{RequeueAfter: r.pollInterval(&virtualMachine)}, r.updateStatus(ctx, &virtualMachine)
 		}
-		status := requestTracker.Payload.Status
+		status := requestTracker.Status
 		log.Info("virtual machine request status: " + *status)
+		recordRequest(&virtualMachine, requestTracker)
+		if virtualMachine.Status.RequestSubmittedAt == nil {
+			// The request was submitted before its start was recorded
+			now := metav1.Now()
+			virtualMachine.Status.RequestSubmittedAt = &now
+		}
+		if *status == models.RequestTrackerStatusINPROGRESS && r.requestTimedOut(&virtualMachine) {
+			return r.requestTimedOutResult(ctx, &virtualMachine)
+		}
 
 		switch *status {
 		case models.RequestTrackerStatusFAILED:
-			virtualMachine.Status = createStatus(
-				machinev1alpha1.ErrorStatusPhase,
+			// A failed request is never polled again. Day-2 operations and
+			// deletions are tried again, a failed create waits for the spec
+			// to change.
+			operation := virtualMachine.Status.Operation
+			setStatus(
+				&virtualMachine,
+				machinev1alpha2.ErrorStatusPhase,
 				"request failed",
-				fmt.Errorf(requestTracker.Payload.Message),
-				virtualMachine.Status.ExternalRequestID,
+				fmt.Errorf(requestTracker.Message),
 				"",
+				virtualMachine.Status.ExternalID,
 			)
+			setCondition(&virtualMachine, machinev1alpha2.RequestInProgressCondition, metav1.ConditionFalse, machinev1alpha2.RequestFailedReason, requestTracker.Message)
+			setCondition(&virtualMachine, machinev1alpha2.FailedCondition, metav1.ConditionTrue, machinev1alpha2.RequestFailedReason, requestTracker.Message)
+			if isDay2Operation(operation) {
+				msg := fmt.Sprintf("%s failed: %s", operation, requestTracker.Message)
+				failOperation(&virtualMachine, operation, requestTracker.Message)
+				setCondition(&virtualMachine, machinev1alpha2.ReadyCondition, metav1.ConditionFalse, machinev1alpha2.OperationFailedReason, msg)
+				return ctrl.Result{RequeueAfter: defaultRequeue}, r.updateStatus(ctx, &virtualMachine)
+			}
+			setCondition(&virtualMachine, machinev1alpha2.ReadyCondition, metav1.ConditionFalse, machinev1alpha2.RequestFailedReason, requestTracker.Message)
+			if !virtualMachine.DeletionTimestamp.IsZero() {
+				setCondition(&virtualMachine, machinev1alpha2.DeletingCondition, metav1.ConditionTrue, machinev1alpha2.DeletionFailedReason, requestTracker.Message)
+			} else if operation == machinev1alpha2.CreateOperation {
+				setCondition(&virtualMachine, machinev1alpha2.ProvisionedCondition, metav1.ConditionFalse, machinev1alpha2.RequestFailedReason, requestTracker.Message)
+				return ctrl.Result{}, r.updateStatus(ctx, &virtualMachine)
+			}
 		case models.RequestTrackerStatusINPROGRESS:
-			virtualMachine.Status = createStatus(
-				machinev1alpha1.InProgressStatusPhase,
+			setStatus(
+				&virtualMachine,
+				machinev1alpha2.InProgressStatusPhase,
 				"request in progress",
 				nil,
-				virtualMachine.Status.ExternalRequestID,
-				"",
+				requestID,
+				virtualMachine.Status.ExternalID,
 			)
+			setCondition(&virtualMachine, machinev1alpha2.RequestInProgressCondition, metav1.ConditionTrue, machinev1alpha2.RequestRunningReason, fmt.Sprintf("request %s is in progress", requestID))
+			setCondition(&virtualMachine, machinev1alpha2.ReadyCondition, metav1.ConditionFalse, machinev1alpha2.RequestRunningReason, fmt.Sprintf("waiting for request %s", requestID))
+			operationProgress(&virtualMachine, requestTracker)
 		case models.RequestTrackerStatusFINISHED:
+			// Keep the machine ID to look the machine up by, unless it is gone
+			machineID := virtualMachine.Status.ExternalID
+			switch virtualMachine.Status.Operation {
+			case machinev1alpha2.CreateOperation:
+				if len(requestTracker.Resources) > 0 {
+					machineID = path.Base(requestTracker.Resources[0])
+				}
+			case machinev1alpha2.DeleteOperation:
+				machineID = ""
+			}
+			finishOperation(&virtualMachine, requestTracker)
 			// Remove the ExternalRequestID from the VirtualMachineStatus
-			virtualMachine.Status = createStatus(
-				machinev1alpha1.RunningStatusPhase,
+			setStatus(
+				&virtualMachine,
+				machinev1alpha2.RunningStatusPhase,
 				"request completed",
 				nil,
 				"",
-				"",
+				machineID,
 			)
+			setCondition(&virtualMachine, machinev1alpha2.RequestInProgressCondition, metav1.ConditionFalse, machinev1alpha2.RequestFinishedReason, fmt.Sprintf("request %s finished", requestID))
+			setCondition(&virtualMachine, machinev1alpha2.FailedCondition, metav1.ConditionFalse, machinev1alpha2.RequestFinishedReason, fmt.Sprintf("request %s finished", requestID))
 		default:
-			virtualMachine.Status = createStatus(
-				machinev1alpha1.ErrorStatusPhase,
-				requestTracker.Payload.Message,
+			setStatus(
+				&virtualMachine,
+				machinev1alpha2.ErrorStatusPhase,
+				requestTracker.Message,
 				fmt.Errorf("machineStateRefreshFunc: unknown status %v", *status),
-				virtualMachine.Status.ExternalRequestID,
-				"",
+				requestID,
+				virtualMachine.Status.ExternalID,
 			)
+			setCondition(&virtualMachine, machinev1alpha2.SyncedCondition, metav1.ConditionFalse, machinev1alpha2.RequestTrackerErrorReason, fmt.Sprintf("unknown request status %v", *status))
 		}
-		return ctrl.Result{RequeueAfter: defaultRequeue}, errors.Wrap(r.Client.Status().Update(ctx, &virtualMachine), "could not update status")
+		return ctrl.Result{RequeueAfter: r.pollInterval(&virtualMachine)}, r.updateStatus(ctx, &virtualMachine)
 	}
 
 	// Delete if it's marked for deletion
 	if !virtualMachine.ObjectMeta.DeletionTimestamp.IsZero() {
 		log.Info("Virtual Machine marked for deletion")
+		if virtualMachine.Spec.DeletionProtection {
+			// Nothing is removed until the protection is cleared, which
+			// triggers another reconcile
+			msg := "deletion is blocked by spec.deletionProtection, set it to false to delete the machine"
+			log.Info(msg)
+			deleting := meta.FindStatusCondition(virtualMachine.Status.Conditions, machinev1alpha2.DeletingCondition)
+			if deleting == nil || deleting.Reason != machinev1alpha2.DeletionProtectedReason {
+				r.Recorder.Event(&virtualMachine, corev1.EventTypeWarning, machinev1alpha2.DeletionProtectedReason, msg)
+			}
+			setCondition(&virtualMachine, machinev1alpha2.DeletingCondition, metav1.ConditionFalse, machinev1alpha2.DeletionProtectedReason, msg)
+			return ctrl.Result{}, r.updateStatus(ctx, &virtualMachine)
+		}
+		setCondition(&virtualMachine, machinev1alpha2.DeletingCondition, metav1.ConditionTrue, machinev1alpha2.DeletionRequestedReason, "VirtualMachine is being deleted")
+		setCondition(&virtualMachine, machinev1alpha2.ReadyCondition, metav1.ConditionFalse, machinev1alpha2.DeletionRequestedReason, "VirtualMachine is being deleted")
 		// The object is being deleted
 		if containsString(virtualMachine.ObjectMeta.Finalizers, virtualMachineFinalizer) {
 			// // our finalizer is present, so lets handle any external dependency
-			if err := r.deleteExternalResources(ctx, &virtualMachine); err != nil {
+			if err := r.deleteExternalResources(ctx, vra, &virtualMachine); err != nil {
 				// if fail to delete the external dependency here, return with error
 				// so that it can be retried
 				return ctrl.Result{}, err
@@ -161,89 +291,179 @@ func (r *VirtualMachineReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 	// register our finalizer if it does not exist
 	if !containsString(virtualMachine.ObjectMeta.Finalizers, virtualMachineFinalizer) {
 		virtualMachine.ObjectMeta.Finalizers = append(virtualMachine.ObjectMeta.Finalizers, virtualMachineFinalizer)
-		if err := r.Update(ctx, &virtualMachine); err != nil {
+		if err := r.update(ctx, &virtualMachine); err != nil {
 			return ctrl.Result{}, errors.Wrap(err, "could not add finalizer")
 		}
 	}
 
 	// Check if the VirtualMachine exists
 	exists := true
-	var filter = "tags.item.key eq 'k8s_name' and tags.item.value eq '" + virtualMachine.GetName() + "'"
-	log.Info("filter: " + filter)
-	var machine *models.Machine
-	machines, err := r.VRA.Compute.GetMachines(compute.NewGetMachinesParams().WithDollarFilter(&filter))
+	machine, foreign, err := findMachine(vra, &virtualMachine, r.ClusterID)
+	if len(foreign) > 0 {
+		log.Info("ignoring machines owned by another VirtualMachine with the same name", "machineIDs", foreign)
+	}
+	var ambiguous *ambiguousMachinesError
+	if errors.As(err, &ambiguous) {
+		setCondition(&virtualMachine, machinev1alpha2.SyncedCondition, metav1.ConditionFalse, machinev1alpha2.MultipleMachinesReason, err.Error())
+		if updateErr := r.updateStatus(ctx, &virtualMachine); updateErr != nil {
+			return ctrl.Result{}, updateErr
+		}
+		return ctrl.Result{}, err
+	}
 	if err != nil {
-		virtualMachine.Status = createStatus(machinev1alpha1.ErrorStatusPhase, "unable to get VirtualMachine from vRealize Automation", err, "", "")
-		return ctrl.Result{}, errors.Wrap(r.Client.Status().Update(ctx, &virtualMachine), "could not update status")
+		setStatus(&virtualMachine, machinev1alpha2.ErrorStatusPhase, "unable to get VirtualMachine from vRealize Automation", err, "", virtualMachine.Status.ExternalID)
+		setCondition(&virtualMachine, machinev1alpha2.SyncedCondition, metav1.ConditionFalse, machinev1alpha2.LookupFailedReason, err.Error())
+		return ctrl.Result{RequeueAfter: defaultRequeue}, r.updateStatus(ctx, &virtualMachine)
+	}
+	if machine == nil && virtualMachine.Spec.AdoptMachineID != "" {
+		// The machine exists already, it is tagged when its tags are synced
+		machine, err = adoptMachine(vra, &virtualMachine, r.ClusterID)
+		if err != nil {
+			msg := fmt.Sprintf("unable to adopt machine %s: %v", virtualMachine.Spec.AdoptMachineID, err)
+			setStatus(&virtualMachine, machinev1alpha2.ErrorStatusPhase, "unable to adopt machine", err, "", "")
+			setCondition(&virtualMachine, machinev1alpha2.ProvisionedCondition, metav1.ConditionFalse, machinev1alpha2.AdoptionFailedReason, msg)
+			setCondition(&virtualMachine, machinev1alpha2.ReadyCondition, metav1.ConditionFalse, machinev1alpha2.AdoptionFailedReason, msg)
+			return ctrl.Result{RequeueAfter: defaultRequeue}, r.updateStatus(ctx, &virtualMachine)
+		}
+		log.Info("adopting machine", "machineID", *machine.ID)
 	}
-	if machines.Payload.TotalElements == 0 {
+	if machine == nil {
 		log.Info("VirtualMachine does not exist in vRealize Automation")
 		exists = false
-	} else if machines.Payload.TotalElements > 1 {
-		return ctrl.Result{}, fmt.Errorf("found more than one VirtualMachine with tag k8s_name:%q", virtualMachine.GetName())
 	} else {
-		// There should be 1 and only 1 VirtualMachine with the tag k8s_name:<name>
-		log.Info("found VirtualMachine with ID: " + *machines.Payload.Content[0].ID)
-		machine = machines.Payload.Content[0]
+		log.Info("found VirtualMachine with ID: " + *machine.ID)
 	}
 
 	// Create the VirtualMachine, if it doesn't exist
 	if !exists {
+		if errs := virtualMachine.ValidateSpec(); len(errs) > 0 {
+			// Nothing is created until the spec is fixed
+			msg := errs.ToAggregate().Error()
+			setStatus(&virtualMachine, machinev1alpha2.ErrorStatusPhase, "invalid VirtualMachine spec", errs.ToAggregate(), "", "")
+			setCondition(&virtualMachine, machinev1alpha2.ProvisionedCondition, metav1.ConditionFalse, machinev1alpha2.InvalidSpecReason, msg)
+			setCondition(&virtualMachine, machinev1alpha2.ReadyCondition, metav1.ConditionFalse, machinev1alpha2.InvalidSpecReason, msg)
+			return ctrl.Result{}, r.updateStatus(ctx, &virtualMachine)
+		}
+		if condition := meta.FindStatusCondition(virtualMachine.Status.Conditions, machinev1alpha2.ProvisionedCondition); condition != nil &&
+			condition.Reason == machinev1alpha2.RequestFailedReason && condition.ObservedGeneration == virtualMachine.Generation {
+			// The create request failed, it is submitted again once the
+			// spec changes
+			return ctrl.Result{}, nil
+		}
+		// The disks are created first so that the machine is provisioned
+		// with them attached
+		if operation := diskOperation(&virtualMachine, false); operation != "" {
+			log.Info("preparing disks", "operation", operation)
+			return r.startOperation(ctx, vra, &virtualMachine, operation)
+		}
+		if !disksCreated(&virtualMachine) {
+			msg := "waiting for the disks of the machine to be created"
+			setStatus(&virtualMachine, machinev1alpha2.ErrorStatusPhase, msg, nil, "", "")
+			setCondition(&virtualMachine, machinev1alpha2.ProvisionedCondition, metav1.ConditionFalse, machinev1alpha2.DiskOperationFailedReason, msg)
+			setCondition(&virtualMachine, machinev1alpha2.ReadyCondition, metav1.ConditionFalse, machinev1alpha2.DiskOperationFailedReason, msg)
+			return ctrl.Result{RequeueAfter: defaultRequeue}, r.updateStatus(ctx, &virtualMachine)
+		}
 		if virtualMachine.Status.ExternalRequestID == "" {
 			log.Info("creating virtual machine request")
-			requestID, err := r.createMachine(virtualMachine)
+			requestID, err := r.createMachine(ctx, vra, virtualMachine)
 			//log.Info(*requestID)
 			if err != nil {
-				virtualMachine.Status = createStatus(machinev1alpha1.ErrorStatusPhase, "unable to create VirtualMachine in vRealize Automation", err, "", "")
+				setStatus(&virtualMachine, machinev1alpha2.ErrorStatusPhase, "unable to create VirtualMachine in vRealize Automation", err, "", "")
+				setCondition(&virtualMachine, machinev1alpha2.ProvisionedCondition, metav1.ConditionFalse, machinev1alpha2.ProvisioningFailedReason, err.Error())
+				setCondition(&virtualMachine, machinev1alpha2.ReadyCondition, metav1.ConditionFalse, machinev1alpha2.ProvisioningFailedReason, err.Error())
+				// A missing boot config source may still show up
+				return ctrl.Result{RequeueAfter: defaultRequeue}, r.updateStatus(ctx, &virtualMachine)
 			} else {
 				// Update VirtualMachineStatus with the request ID
-				virtualMachine.Status = createStatus(machinev1alpha1.CreatingStatusPhase, "created VirtualMachine in vRealize Automation", nil, *requestID, "")
+				setStatus(&virtualMachine, machinev1alpha2.CreatingStatusPhase, "created VirtualMachine in vRealize Automation", nil, *requestID, "")
+				virtualMachine.Status.Operation = machinev1alpha2.CreateOperation
+				virtualMachine.Status.ManagedTagKeys = tagKeys(desiredTags(&virtualMachine, r.ClusterID))
+				if remoteAccess := virtualMachine.Spec.RemoteAccess; remoteAccess != nil && remoteAccess.Authentication == machinev1alpha2.GeneratedKeyPairAuthentication {
+					virtualMachine.Status.PrivateKeySecretName = privateKeySecretName(&virtualMachine)
+				}
+				setCondition(&virtualMachine, machinev1alpha2.ProvisionedCondition, metav1.ConditionFalse, machinev1alpha2.ProvisioningReason, "machine is being created in vRealize Automation")
+				setCondition(&virtualMachine, machinev1alpha2.RequestInProgressCondition, metav1.ConditionTrue, machinev1alpha2.RequestSubmittedReason, fmt.Sprintf("create request %s submitted", *requestID))
+				setCondition(&virtualMachine, machinev1alpha2.ReadyCondition, metav1.ConditionFalse, machinev1alpha2.ProvisioningReason, "machine is being created in vRealize Automation")
 			}
-			return ctrl.Result{}, errors.Wrap(r.Client.Status().Update(ctx, &virtualMachine), "could not update status")
+			return ctrl.Result{}, r.updateStatus(ctx, &virtualMachine)
 		}
 	}
 
-	// Check the state matches the desired state
+	// Record the machine as seen in vRA
+	previous := virtualMachine.Status.Machine
+	virtualMachine.Status.Machine = observedMachine(machine)
+	nics, err := observedNetworkInterfaces(vra, machine)
+	if err != nil {
+		setStatus(&virtualMachine, machinev1alpha2.ErrorStatusPhase, "unable to get the network interfaces of the machine", err, "", *machine.ID)
+		setCondition(&virtualMachine, machinev1alpha2.SyncedCondition, metav1.ConditionFalse, machinev1alpha2.LookupFailedReason, err.Error())
+		return ctrl.Result{RequeueAfter: defaultRequeue}, r.updateStatus(ctx, &virtualMachine)
+	}
+	virtualMachine.Status.Machine.NetworkInterfaces = nics
+	if virtualMachine.Status.Machine.Flavor == "" {
+		// vRA does not report the flavor of every machine, keep the one it
+		// was last given by the controller
+		if previous != nil && previous.Flavor != "" {
+			virtualMachine.Status.Machine.Flavor = previous.Flavor
+		} else {
+			virtualMachine.Status.Machine.Flavor = virtualMachine.Spec.Flavor
+		}
+	}
+	setCondition(&virtualMachine, machinev1alpha2.SyncedCondition, metav1.ConditionTrue, machinev1alpha2.SyncedReason, "machine state recorded from vRealize Automation")
+	if err := syncTags(vra, &virtualMachine, machine, r.ClusterID); err != nil {
+		setStatus(&virtualMachine, machinev1alpha2.ErrorStatusPhase, "unable to update the tags of the machine", err, "", *machine.ID)
+		setCondition(&virtualMachine, machinev1alpha2.ReadyCondition, metav1.ConditionFalse, machinev1alpha2.TagUpdateFailedReason, err.Error())
+		return ctrl.Result{RequeueAfter: defaultRequeue}, r.updateStatus(ctx, &virtualMachine)
+	}
+	if err := r.publishConnectionDetails(ctx, &virtualMachine); err != nil {
+		setStatus(&virtualMachine, machinev1alpha2.ErrorStatusPhase, "unable to publish the connection details of the machine", err, "", *machine.ID)
+		setCondition(&virtualMachine, machinev1alpha2.ConnectionDetailsPublishedCondition, metav1.ConditionFalse, machinev1alpha2.ConnectionSecretReason, err.Error())
+		setCondition(&virtualMachine, machinev1alpha2.ReadyCondition, metav1.ConditionFalse, machinev1alpha2.ConnectionSecretReason, err.Error())
+		return ctrl.Result{RequeueAfter: defaultRequeue}, r.updateStatus(ctx, &virtualMachine)
+	}
 
-	// Update the VirtualMachine
-	virtualMachine.Spec.Address = machine.Address
-	virtualMachine.Spec.BootConfig = machine.BootConfig
-	virtualMachine.Spec.CloudAccountIds = machine.CloudAccountIds
-	virtualMachine.Spec.CreatedAt = machine.CreatedAt
-	virtualMachine.Spec.CustomProperties = machine.CustomProperties
-	virtualMachine.Spec.DeploymentID = machine.DeploymentID
-	virtualMachine.Spec.Description = machine.Description
-	virtualMachine.Spec.ExternalID = machine.ExternalID
-	virtualMachine.Spec.ExternalRegionID = machine.ExternalRegionID
-	virtualMachine.Spec.ExternalZoneID = machine.ExternalZoneID
-	virtualMachine.Spec.Hostname = machine.Hostname
-	virtualMachine.Spec.ID = machine.ID
-	virtualMachine.Spec.OrgID = machine.OrgID
-	virtualMachine.Spec.Owner = machine.Owner
-	virtualMachine.Spec.PowerState = machine.PowerState
-	virtualMachine.Spec.ProjectID = machine.ProjectID
-	virtualMachine.Spec.UpdatedAt = machine.UpdatedAt
-
-	updateVMError := r.Client.Update(ctx, &virtualMachine)
-	if updateVMError != nil {
-		log.Error(updateVMError, "unable to update VirtualMachine state")
+	// Check the state matches the desired state
+	if operation := powerOperation(virtualMachine.Spec.PowerState, virtualMachine.Status.Machine.PowerState); operation != "" {
+		log.Info("changing power state", "operation", operation, "powerState", virtualMachine.Spec.PowerState)
+		return r.startOperation(ctx, vra, &virtualMachine, operation)
+	}
+	if operation := resizeOperation(&virtualMachine); operation != "" {
+		log.Info("resizing machine", "from", virtualMachine.Status.Machine.Flavor, "to", virtualMachine.Spec.Flavor)
+		return r.startOperation(ctx, vra, &virtualMachine, operation)
 	}
+	if len(virtualMachine.Spec.Disks) > 0 || len(virtualMachine.Status.Disks) > 0 {
+		attached, err := vra.GetMachineDisks(*machine.ID)
+		if err != nil {
+			setStatus(&virtualMachine, machinev1alpha2.ErrorStatusPhase, "unable to get the disks of the machine", err, "", *machine.ID)
+			setCondition(&virtualMachine, machinev1alpha2.SyncedCondition, metav1.ConditionFalse, machinev1alpha2.LookupFailedReason, err.Error())
+			return ctrl.Result{RequeueAfter: defaultRequeue}, r.updateStatus(ctx, &virtualMachine)
+		}
+		observeDisks(&virtualMachine, attached)
+		if operation := diskOperation(&virtualMachine, true); operation != "" {
+			log.Info("updating disks", "operation", operation)
+			return r.startOperation(ctx, vra, &virtualMachine, operation)
+		}
+	}
+	setDisksCondition(&virtualMachine)
 
 	// Create the Status
-	virtualMachine.Status = createStatus(machinev1alpha1.RunningStatusPhase, "ready", nil, "", *machine.ID)
+	setStatus(&virtualMachine, machinev1alpha2.RunningStatusPhase, "ready", nil, "", *machine.ID)
+	setCondition(&virtualMachine, machinev1alpha2.ProvisionedCondition, metav1.ConditionTrue, machinev1alpha2.MachineFoundReason, fmt.Sprintf("machine %s exists in vRealize Automation", *machine.ID))
+	setCondition(&virtualMachine, machinev1alpha2.ReadyCondition, metav1.ConditionTrue, machinev1alpha2.MachineReadyReason, "machine is ready")
 
-	return ctrl.Result{}, errors.Wrap(r.Client.Status().Update(ctx, &virtualMachine), "could not update status")
+	return ctrl.Result{RequeueAfter: r.resyncInterval()}, r.updateStatus(ctx, &virtualMachine)
 
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *VirtualMachineReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&machinev1alpha1.VirtualMachine{}).
+		For(&machinev1alpha2.VirtualMachine{}).
+		Owns(&corev1.Secret{}).
+		Owns(&corev1.ConfigMap{}).
 		Complete(r)
 }
 
-func (r *VirtualMachineReconciler) deleteExternalResources(ctx context.Context, virtualMachine *machinev1alpha1.VirtualMachine) error {
+func (r *VirtualMachineReconciler) deleteExternalResources(ctx context.Context, vra VRAClient, virtualMachine *machinev1alpha2.VirtualMachine) error {
 	// Ensure that delete implementation is idempotent and safe to invoke
 	// multiple times for same object.
 	log := r.Log.WithValues("virtualmachine", virtualMachine.Namespace)
@@ -254,67 +474,289 @@ func (r *VirtualMachineReconciler) deleteExternalResources(ctx context.Context,
 		return nil
 	}
 
-	if virtualMachine.Status.ExternalID != "" {
-		deleteRequest, deleteError := r.VRA.Compute.DeleteMachine(compute.NewDeleteMachineParams().WithID(*virtualMachine.Spec.ID))
-		if deleteError != nil {
-			return deleteError
+	// The recorded machine may be gone, or the status lost, so the machine
+	// is looked up like when it is reconciled
+	machine, _, err := findMachine(vra, virtualMachine, r.ClusterID)
+	if err != nil {
+		setCondition(virtualMachine, machinev1alpha2.DeletingCondition, metav1.ConditionTrue, machinev1alpha2.DeletionFailedReason, err.Error())
+		if updateErr := r.updateStatus(ctx, virtualMachine); updateErr != nil {
+			return updateErr
 		}
-		// Add the external request ID to the VirtualMachineStatus
-		virtualMachine.Status = createStatus(machinev1alpha1.PendingStatusPhase, "deleting Virtual Machine", nil, *deleteRequest.Payload.ID, virtualMachine.Status.ExternalID)
+		return err
+	}
+	if machine == nil {
+		log.Info("machine does not exist in vRealize Automation")
+		setStatus(virtualMachine, virtualMachine.Status.Phase, "machine does not exist in vRealize Automation", nil, "", "")
+		return r.deleteDisks(ctx, vra, virtualMachine)
+	}
+	machineID := *machine.ID
+
+	if policy := r.deletionPolicy(virtualMachine); policy != machinev1alpha2.DeleteDeletionPolicy {
+		powerOffRequest, err := retainMachine(vra, machine, policy)
+		if err != nil {
+			setCondition(virtualMachine, machinev1alpha2.DeletingCondition, metav1.ConditionTrue, machinev1alpha2.DeletionFailedReason, err.Error())
+			if updateErr := r.updateStatus(ctx, virtualMachine); updateErr != nil {
+				return updateErr
+			}
+			return err
+		}
+		if powerOffRequest != nil {
+			// The machine is released once the request has finished
+			setStatus(virtualMachine, machinev1alpha2.PendingStatusPhase, "powering off Virtual Machine", nil, *powerOffRequest.ID, machineID)
+			virtualMachine.Status.Operation = machinev1alpha2.PowerOffOperation
+			setCondition(virtualMachine, machinev1alpha2.RequestInProgressCondition, metav1.ConditionTrue, machinev1alpha2.RequestSubmittedReason, fmt.Sprintf("%s request %s submitted", machinev1alpha2.PowerOffOperation, *powerOffRequest.ID))
+		} else {
+			log.Info("leaving machine in vRealize Automation", "machineID", machineID, "deletionPolicy", policy)
+			setStatus(virtualMachine, virtualMachine.Status.Phase, fmt.Sprintf("machine %s left in vRealize Automation", machineID), nil, "", "")
+		}
+		return r.updateStatus(ctx, virtualMachine)
+	}
 
+	deleteRequest, deleteError := vra.DeleteMachine(machineID)
+	if deleteError != nil {
+		setCondition(virtualMachine, machinev1alpha2.DeletingCondition, metav1.ConditionTrue, machinev1alpha2.DeletionFailedReason, deleteError.Error())
+		if err := r.updateStatus(ctx, virtualMachine); err != nil {
+			return err
+		}
+		return deleteError
+	}
+	if deleteRequest == nil {
+		// The machine went away since it was looked up
+		log.Info("machine does not exist in vRealize Automation", "machineID", machineID)
+		setStatus(virtualMachine, virtualMachine.Status.Phase, "machine does not exist in vRealize Automation", nil, "", "")
+		return r.deleteDisks(ctx, vra, virtualMachine)
 	}
+	// Add the external request ID to the VirtualMachineStatus, the finalizer
+	// is removed once the request has finished
+	setStatus(virtualMachine, machinev1alpha2.PendingStatusPhase, "deleting Virtual Machine", nil, *deleteRequest.ID, machineID)
+	virtualMachine.Status.Operation = machinev1alpha2.DeleteOperation
+	setCondition(virtualMachine, machinev1alpha2.RequestInProgressCondition, metav1.ConditionTrue, machinev1alpha2.RequestSubmittedReason, fmt.Sprintf("delete request %s submitted", *deleteRequest.ID))
+
 	// Update the VirtualMachineStatus and return nil, or error if update fails
+	return r.updateStatus(ctx, virtualMachine)
+}
+
+// deleteDisks deletes the disks left behind once the machine is gone, such as
+// the disks created for a machine whose create request failed, unless the
+// deletion policy retains the machine. The finalizer is removed once no disk
+// is being deleted.
+func (r *VirtualMachineReconciler) deleteDisks(ctx context.Context, vra VRAClient, virtualMachine *machinev1alpha2.VirtualMachine) error {
+	if r.deletionPolicy(virtualMachine) != machinev1alpha2.DeleteDeletionPolicy {
+		return r.updateStatus(ctx, virtualMachine)
+	}
+	request, err := deleteDetachedDisks(vra, virtualMachine)
+	if err != nil {
+		setCondition(virtualMachine, machinev1alpha2.DeletingCondition, metav1.ConditionTrue, machinev1alpha2.DeletionFailedReason, err.Error())
+		if updateErr := r.updateStatus(ctx, virtualMachine); updateErr != nil {
+			return updateErr
+		}
+		return err
+	}
+	if request != nil {
+		setStatus(virtualMachine, machinev1alpha2.PendingStatusPhase, "deleting the disks of the Virtual Machine", nil, *request.ID, "")
+		virtualMachine.Status.Operation = machinev1alpha2.DeleteDiskOperation
+		setCondition(virtualMachine, machinev1alpha2.RequestInProgressCondition, metav1.ConditionTrue, machinev1alpha2.RequestSubmittedReason, fmt.Sprintf("%s request %s submitted", machinev1alpha2.DeleteDiskOperation, *request.ID))
+	}
+	return r.updateStatus(ctx, virtualMachine)
+}
+
+// startOperation submits a day-2 operation on the machine and records the
+// request to track
+func (r *VirtualMachineReconciler) startOperation(ctx context.Context, vra VRAClient, virtualMachine *machinev1alpha2.VirtualMachine, operation machinev1alpha2.Operation) (ctrl.Result, error) {
+	machineID := ""
+	if virtualMachine.Status.Machine != nil {
+		machineID = virtualMachine.Status.Machine.ID
+	}
+	request, err := requestOperation(vra, virtualMachine, operation, r.ClusterID)
+	if err != nil {
+		setStatus(virtualMachine, machinev1alpha2.ErrorStatusPhase, fmt.Sprintf("unable to start %s", operation), err, "", machineID)
+		setCondition(virtualMachine, machinev1alpha2.ReadyCondition, metav1.ConditionFalse, machinev1alpha2.OperationFailedReason, err.Error())
+		failOperation(virtualMachine, operation, err.Error())
+		return ctrl.Result{RequeueAfter: defaultRequeue}, r.updateStatus(ctx, virtualMachine)
+	}
+	if request == nil {
+		// vRA did it without a request to track
+		virtualMachine.Status.Operation = operation
+		finishOperation(virtualMachine, nil)
+		setStatus(virtualMachine, machinev1alpha2.RunningStatusPhase, fmt.Sprintf("%s completed", operation), nil, "", machineID)
+		setCondition(virtualMachine, machinev1alpha2.FailedCondition, metav1.ConditionFalse, machinev1alpha2.RequestFinishedReason, fmt.Sprintf("%s completed", operation))
+		return ctrl.Result{Requeue: true}, r.updateStatus(ctx, virtualMachine)
+	}
+
+	setStatus(virtualMachine, machinev1alpha2.InProgressStatusPhase, fmt.Sprintf("%s requested", operation), nil, *request.ID, machineID)
+	virtualMachine.Status.Operation = operation
+	operationStarted(virtualMachine, operation)
+	setCondition(virtualMachine, machinev1alpha2.RequestInProgressCondition, metav1.ConditionTrue, machinev1alpha2.RequestSubmittedReason, fmt.Sprintf("%s request %s submitted", operation, *request.ID))
+	setCondition(virtualMachine, machinev1alpha2.ReadyCondition, metav1.ConditionFalse, machinev1alpha2.RequestSubmittedReason, fmt.Sprintf("waiting for %s to finish", operation))
+	return ctrl.Result{RequeueAfter: r.pollInterval(virtualMachine)}, r.updateStatus(ctx, virtualMachine)
+}
+
+// requestTimedOutResult reports the tracked request as failed once it has
+// run longer than the timeout of its operation. Day-2 operations are given up
+// so that they can be tried again. Create and delete requests are still
+// polled, as submitting them again could leave two machines behind.
+func (r *VirtualMachineReconciler) requestTimedOutResult(ctx context.Context, virtualMachine *machinev1alpha2.VirtualMachine) (ctrl.Result, error) {
+	operation := virtualMachine.Status.Operation
+	requestID := virtualMachine.Status.ExternalRequestID
+	msg := fmt.Sprintf("%s request %s did not finish within %s", operation, requestID, r.requestTimeout(operation))
+	if isDay2Operation(operation) {
+		failOperation(virtualMachine, operation, msg)
+		setCondition(virtualMachine, machinev1alpha2.RequestInProgressCondition, metav1.ConditionFalse, machinev1alpha2.RequestTimedOutReason, msg)
+		requestID = ""
+	}
+	switch operation {
+	case machinev1alpha2.CreateOperation:
+		setCondition(virtualMachine, machinev1alpha2.ProvisionedCondition, metav1.ConditionFalse, machinev1alpha2.RequestTimedOutReason, msg)
+	case machinev1alpha2.DeleteOperation:
+		setCondition(virtualMachine, machinev1alpha2.DeletingCondition, metav1.ConditionTrue, machinev1alpha2.RequestTimedOutReason, msg)
+	}
+	setStatus(virtualMachine, machinev1alpha2.ErrorStatusPhase, msg, nil, requestID, virtualMachine.Status.ExternalID)
+	setCondition(virtualMachine, machinev1alpha2.ReadyCondition, metav1.ConditionFalse, machinev1alpha2.RequestTimedOutReason, msg)
+	setCondition(virtualMachine, machinev1alpha2.FailedCondition, metav1.ConditionTrue, machinev1alpha2.RequestTimedOutReason, msg)
+	return ctrl.Result{RequeueAfter: r.pollInterval(virtualMachine)}, r.updateStatus(ctx, virtualMachine)
+}
+
+// resyncInterval returns how long to wait before checking a ready machine
+// again
+func (r *VirtualMachineReconciler) resyncInterval() time.Duration {
+	if r.ResyncInterval > 0 {
+		return r.ResyncInterval
+	}
+	return defaultResync
+}
+
+// update writes virtualMachine, keeping the status set in memory so that it
+// can still be written by updateStatus
+func (r *VirtualMachineReconciler) update(ctx context.Context, virtualMachine *machinev1alpha2.VirtualMachine) error {
+	status := virtualMachine.Status.DeepCopy()
+	err := r.Update(ctx, virtualMachine)
+	virtualMachine.Status = *status
+	return err
+}
+
+// updateStatus writes the status of virtualMachine, recording the generation
+// it was based on
+func (r *VirtualMachineReconciler) updateStatus(ctx context.Context, virtualMachine *machinev1alpha2.VirtualMachine) error {
+	virtualMachine.Status.ObservedGeneration = virtualMachine.Generation
 	return errors.Wrap(r.Client.Status().Update(ctx, virtualMachine), "could not update status")
 }
 
-func createStatus(phase machinev1alpha1.StatusPhase, msg string, err error, requestID string, machineID string) machinev1alpha1.VirtualMachineStatus {
+// setStatus records the phase and last message, conditions are left alone.
+// The operation and its target are forgotten along with the request, the
+// progress of a request is kept until another one is submitted.
+func setStatus(virtualMachine *machinev1alpha2.VirtualMachine, phase machinev1alpha2.StatusPhase, msg string, err error, requestID string, machineID string) {
 	if err != nil {
 		msg = msg + ": " + err.Error()
 	}
+	if requestID == "" {
+		virtualMachine.Status.RequestSubmittedAt = nil
+	} else if requestID != virtualMachine.Status.ExternalRequestID {
+		now := metav1.Now()
+		virtualMachine.Status.RequestSubmittedAt = &now
+		virtualMachine.Status.RequestProgress = 0
+		virtualMachine.Status.RequestResources = nil
+	}
 
-	status := machinev1alpha1.VirtualMachineStatus{
-		Phase:             phase,
-		LastMessage:       msg,
-		ExternalRequestID: requestID,
-		ExternalID:        machineID,
+	virtualMachine.Status.Phase = phase
+	virtualMachine.Status.LastMessage = msg
+	virtualMachine.Status.ExternalRequestID = requestID
+	virtualMachine.Status.ExternalID = machineID
+	if requestID == "" {
+		virtualMachine.Status.Operation = ""
+		virtualMachine.Status.RequestedFlavor = ""
 	}
-	return status
 }
 
-func (r *VirtualMachineReconciler) createMachine(virtualMachine machinev1alpha1.VirtualMachine) (*string, error) {
+// setCondition records a condition for the current generation, the
+// transition time only changes with the status
+func setCondition(virtualMachine *machinev1alpha2.VirtualMachine, conditionType string, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&virtualMachine.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: virtualMachine.Generation,
+	})
+}
+
+func (r *VirtualMachineReconciler) createMachine(ctx context.Context, vra VRAClient, virtualMachine machinev1alpha2.VirtualMachine) (*string, error) {
 	name := virtualMachine.GetName()
-	namespace := virtualMachine.GetNamespace()
 	constraints := expandConstraints(virtualMachine.Spec.Constraints)
-	k8sName := "k8s_name"
-	k8sNamespace := "k8s_namespace"
-	tags := expandTags(virtualMachine.Spec.Tags)
-	tags = append(tags, &models.Tag{
-		Key:   &k8sName,
-		Value: &name,
-	})
-	tags = append(tags, &models.Tag{
-		Key:   &k8sNamespace,
-		Value: &namespace,
-	})
+	tags := desiredTags(&virtualMachine, r.ClusterID)
+
+	nics, err := expandNetworkInterfaces(vra, virtualMachine.Spec.ProjectID, virtualMachine.Spec.NetworkInterfaces)
+	if err != nil {
+		return nil, err
+	}
+	bootConfig, err := r.bootConfig(ctx, &virtualMachine)
+	if err != nil {
+		return nil, err
+	}
+	remoteAccess, err := r.remoteAccess(ctx, &virtualMachine)
+	if err != nil {
+		return nil, err
+	}
 
+	// Each VirtualMachine is a single machine
 	machineSpecification := models.MachineSpecification{
-		Name:        &name,
-		Flavor:      &virtualMachine.Spec.Flavor,
-		ProjectID:   &virtualMachine.Spec.ProjectID,
-		Constraints: constraints,
-		Tags:        tags,
-		Image:       &virtualMachine.Spec.Image,
-	}
-	createMachineCreated, err := r.VRA.Compute.CreateMachine(compute.NewCreateMachineParams().WithBody(&machineSpecification))
+		Name:                 &name,
+		Description:          virtualMachine.Spec.Description,
+		Flavor:               &virtualMachine.Spec.Flavor,
+		ProjectID:            &virtualMachine.Spec.ProjectID,
+		Constraints:          constraints,
+		CustomProperties:     virtualMachine.Spec.CustomProperties,
+		Tags:                 tags,
+		ImageDiskConstraints: expandConstraints(virtualMachine.Spec.ImageDiskConstraints),
+		Disks:                expandDisks(&virtualMachine),
+		Nics:                 nics,
+		BootConfig:           bootConfig,
+		RemoteAccess:         remoteAccess,
+		MachineCount:         1,
+	}
+	if virtualMachine.Spec.ImageRef != "" {
+		machineSpecification.ImageRef = &virtualMachine.Spec.ImageRef
+	} else {
+		machineSpecification.Image = &virtualMachine.Spec.Image
+	}
+	requestTracker, err := vra.CreateMachine(&machineSpecification)
 	if err != nil {
 		return nil, err
 	}
-	return createMachineCreated.Payload.ID, nil
+	return requestTracker.ID, nil
+}
+
+// observedMachine returns the status fields recorded for machine
+func observedMachine(machine *models.Machine) *machinev1alpha2.MachineStatus {
+	observed := &machinev1alpha2.MachineStatus{
+		ID:              *machine.ID,
+		Address:         machine.Address,
+		Hostname:        machine.Hostname,
+		ExternalID:      machine.ExternalID,
+		CloudAccountIds: machine.CloudAccountIds,
+		DeploymentID:    machine.DeploymentID,
+		ProjectID:       machine.ProjectID,
+		OrgID:           machine.OrgID,
+		Owner:           machine.Owner,
+		CreatedAt:       machine.CreatedAt,
+		UpdatedAt:       machine.UpdatedAt,
+	}
+	if machine.PowerState != nil {
+		observed.PowerState = machinev1alpha2.PowerState(*machine.PowerState)
+	}
+	if machine.ExternalRegionID != nil {
+		observed.ExternalRegionID = *machine.ExternalRegionID
+	}
+	if machine.ExternalZoneID != nil {
+		observed.ExternalZoneID = *machine.ExternalZoneID
+	}
+	observed.Flavor = machine.CustomProperties["flavor"]
+	return observed
 }
 
-func expandConstraints(configConstraints []machinev1alpha1.Constraint) []*models.Constraint {
+func expandConstraints(configConstraints []machinev1alpha2.Constraint) []*models.Constraint {
 	constraints := make([]*models.Constraint, 0, len(configConstraints))
 	for _, configConstraint := range configConstraints {
+		configConstraint := configConstraint
 		constraint := models.Constraint{
 			Mandatory:  &configConstraint.Mandatory,
 			Expression: &configConstraint.Expression,
@@ -325,12 +767,13 @@ func expandConstraints(configConstraints []machinev1alpha1.Constraint) []*models
 	return constraints
 }
 
-func expandTags(configTags []machinev1alpha1.Tag) []*models.Tag {
+func expandTags(configTags []machinev1alpha2.Tag) []*models.Tag {
 	//tags := make([]*models.Tag, 0, len(configTags))
 
 	var tags []*models.Tag
 
 	for _, configTag := range configTags {
+		configTag := configTag
 		tag := models.Tag{
 			Key:   &configTag.Key,
 			Value: &configTag.Value,
@@ -0,0 +1,83 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"github.com/pkg/errors"
+	machinev1alpha2 "github.com/sammcgeown/vra/api/v1alpha2"
+	"github.com/vmware/vra-sdk-go/pkg/models"
+)
+
+// deletionPolicy returns what happens to the machine of virtualMachine when
+// it is deleted: the policy in the spec, else the default of the controller,
+// else Delete
+func (r *VirtualMachineReconciler) deletionPolicy(virtualMachine *machinev1alpha2.VirtualMachine) machinev1alpha2.DeletionPolicy {
+	if virtualMachine.Spec.DeletionPolicy != "" {
+		return virtualMachine.Spec.DeletionPolicy
+	}
+	if r.DefaultDeletionPolicy != "" {
+		return r.DefaultDeletionPolicy
+	}
+	return machinev1alpha2.DeleteDeletionPolicy
+}
+
+// ValidDeletionPolicy reports whether policy is one of the deletion policies
+func ValidDeletionPolicy(policy machinev1alpha2.DeletionPolicy) bool {
+	switch policy {
+	case machinev1alpha2.DeleteDeletionPolicy, machinev1alpha2.OrphanDeletionPolicy, machinev1alpha2.PowerOffAndRetainDeletionPolicy:
+		return true
+	}
+	return false
+}
+
+// retainMachine leaves machine in vRA, without the tags that tie it to its
+// VirtualMachine. With PowerOffAndRetain the machine is powered off first, the
+// request to wait for is returned and the tags stay until the machine is off.
+func retainMachine(vra VRAClient, machine *models.Machine, policy machinev1alpha2.DeletionPolicy) (*models.RequestTracker, error) {
+	id := *machine.ID
+	if policy == machinev1alpha2.PowerOffAndRetainDeletionPolicy && (machine.PowerState == nil || !isPoweredOff(machinev1alpha2.PowerState(*machine.PowerState))) {
+		request, err := vra.PowerOffMachine(id)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to power off machine %s", id)
+		}
+		if request != nil {
+			return request, nil
+		}
+	}
+
+	if _, err := vra.UpdateMachine(id, &models.UpdateMachineSpecification{Tags: withoutOwnershipTags(machine.Tags)}); err != nil {
+		return nil, errors.Wrapf(err, "unable to remove the ownership tags of machine %s", id)
+	}
+	return nil, nil
+}
+
+// withoutOwnershipTags returns tags without the ones the controller finds
+// machines by, never nil so that vRA clears the tags when none are left
+func withoutOwnershipTags(tags []*models.Tag) []*models.Tag {
+	kept := []*models.Tag{}
+	for _, tag := range tags {
+		if tag.Key == nil {
+			continue
+		}
+		switch *tag.Key {
+		case nameTag, namespaceTag, uidTag, clusterTag:
+			continue
+		}
+		kept = append(kept, tag)
+	}
+	return kept
+}
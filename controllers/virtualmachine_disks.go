@@ -0,0 +1,324 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/vmware/vra-sdk-go/pkg/models"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	machinev1alpha2 "github.com/sammcgeown/vra/api/v1alpha2"
+)
+
+// observeDisks records the capacity of the disks in the status and whether
+// they are attached, from the block devices attached to the machine
+func observeDisks(virtualMachine *machinev1alpha2.VirtualMachine, attached []*models.BlockDevice) {
+	devices := map[string]*models.BlockDevice{}
+	for _, device := range attached {
+		if device.ID != nil {
+			devices[*device.ID] = device
+		}
+	}
+
+	for i := range virtualMachine.Status.Disks {
+		disk := &virtualMachine.Status.Disks[i]
+		if disk.ID == "" {
+			continue
+		}
+		device, ok := devices[disk.ID]
+		switch {
+		case ok && device.CapacityInGB != nil:
+			disk.CapacityInGB = *device.CapacityInGB
+			if disk.State == machinev1alpha2.AvailableDiskState {
+				disk.State = machinev1alpha2.AttachedDiskState
+			}
+		case !ok && disk.State == machinev1alpha2.AttachedDiskState:
+			disk.State = machinev1alpha2.AvailableDiskState
+		}
+	}
+}
+
+// diskOperation returns the next operation that brings the disks in line with
+// the spec, or "" when there is none, and puts the disk it works on in the
+// matching transitional state. Before the machine exists disks are only
+// created and deleted. Disk operations that failed are not tried again until
+// the spec changes.
+func diskOperation(virtualMachine *machinev1alpha2.VirtualMachine, machineExists bool) machinev1alpha2.Operation {
+	condition := meta.FindStatusCondition(virtualMachine.Status.Conditions, machinev1alpha2.DisksSyncedCondition)
+	if condition != nil && condition.Reason == machinev1alpha2.DiskOperationFailedReason && condition.ObservedGeneration == virtualMachine.Generation {
+		return ""
+	}
+
+	status := &virtualMachine.Status
+	for _, disk := range virtualMachine.Spec.Disks {
+		current := findDiskStatus(status.Disks, disk.Name)
+		if current == nil {
+			status.Disks = append(status.Disks, machinev1alpha2.DiskStatus{
+				Name:       disk.Name,
+				Persistent: disk.Persistent,
+				State:      machinev1alpha2.CreatingDiskState,
+			})
+			return machinev1alpha2.CreateDiskOperation
+		}
+		if !machineExists {
+			continue
+		}
+		if current.State == machinev1alpha2.AvailableDiskState {
+			current.State = machinev1alpha2.AttachingDiskState
+			return machinev1alpha2.AttachDiskOperation
+		}
+		if current.State == machinev1alpha2.AttachedDiskState && disk.CapacityInGB > current.CapacityInGB {
+			current.State = machinev1alpha2.ResizingDiskState
+			return machinev1alpha2.ResizeDiskOperation
+		}
+	}
+
+	// Persistent disks that have been detached are left in vRA
+	kept := status.Disks[:0]
+	for _, disk := range status.Disks {
+		if findDisk(virtualMachine.Spec.Disks, disk.Name) != nil || !disk.Persistent || disk.State != machinev1alpha2.AvailableDiskState {
+			kept = append(kept, disk)
+		}
+	}
+	status.Disks = kept
+
+	for i := range status.Disks {
+		disk := &status.Disks[i]
+		if findDisk(virtualMachine.Spec.Disks, disk.Name) != nil {
+			continue
+		}
+		if disk.State == machinev1alpha2.AttachedDiskState && machineExists {
+			disk.State = machinev1alpha2.DetachingDiskState
+			return machinev1alpha2.DetachDiskOperation
+		}
+		if disk.State == machinev1alpha2.AvailableDiskState {
+			disk.State = machinev1alpha2.DeletingDiskState
+			return machinev1alpha2.DeleteDiskOperation
+		}
+	}
+	return ""
+}
+
+// setDisksCondition reports whether the disks match the spec once there is
+// nothing left to do for them
+func setDisksCondition(virtualMachine *machinev1alpha2.VirtualMachine) {
+	condition := meta.FindStatusCondition(virtualMachine.Status.Conditions, machinev1alpha2.DisksSyncedCondition)
+	if condition != nil && condition.Reason == machinev1alpha2.DiskOperationFailedReason && condition.ObservedGeneration == virtualMachine.Generation {
+		return
+	}
+	for _, disk := range virtualMachine.Spec.Disks {
+		current := findDiskStatus(virtualMachine.Status.Disks, disk.Name)
+		if current != nil && disk.CapacityInGB < current.CapacityInGB {
+			setCondition(virtualMachine, machinev1alpha2.DisksSyncedCondition, metav1.ConditionFalse, machinev1alpha2.DiskShrinkReason,
+				fmt.Sprintf("disk %s has %d GB and cannot shrink to %d GB", disk.Name, current.CapacityInGB, disk.CapacityInGB))
+			return
+		}
+	}
+	setCondition(virtualMachine, machinev1alpha2.DisksSyncedCondition, metav1.ConditionTrue, machinev1alpha2.DisksMatchReason, fmt.Sprintf("%d disks attached", len(virtualMachine.Spec.Disks)))
+}
+
+// disksCreated reports whether every disk in the spec has a block device
+// that can be attached when the machine is created
+func disksCreated(virtualMachine *machinev1alpha2.VirtualMachine) bool {
+	for _, disk := range virtualMachine.Spec.Disks {
+		current := findDiskStatus(virtualMachine.Status.Disks, disk.Name)
+		if current == nil || current.State != machinev1alpha2.AvailableDiskState {
+			return false
+		}
+	}
+	return true
+}
+
+// expandDisks returns the attachments of the disks in the spec
+func expandDisks(virtualMachine *machinev1alpha2.VirtualMachine) []*models.DiskAttachmentSpecification {
+	var disks []*models.DiskAttachmentSpecification
+	for _, disk := range virtualMachine.Spec.Disks {
+		current := findDiskStatus(virtualMachine.Status.Disks, disk.Name)
+		if current == nil || current.ID == "" {
+			continue
+		}
+		id := current.ID
+		disks = append(disks, &models.DiskAttachmentSpecification{
+			BlockDeviceID: &id,
+			Name:          disk.Name,
+			Description:   disk.Description,
+		})
+	}
+	return disks
+}
+
+// requestDiskOperation submits operation for the disk in a transitional
+// state
+func requestDiskOperation(vra VRAClient, virtualMachine *machinev1alpha2.VirtualMachine, operation machinev1alpha2.Operation, clusterID string) (*models.RequestTracker, error) {
+	disk := pendingDisk(virtualMachine)
+	if disk == nil {
+		return nil, fmt.Errorf("no disk to %s", operation)
+	}
+	spec := findDisk(virtualMachine.Spec.Disks, disk.Name)
+
+	switch operation {
+	case machinev1alpha2.CreateDiskOperation:
+		return vra.CreateBlockDevice(blockDeviceSpecification(virtualMachine, spec, clusterID))
+	case machinev1alpha2.AttachDiskOperation:
+		return vra.AttachMachineDisk(virtualMachine.Status.Machine.ID, disk.ID, disk.Name)
+	case machinev1alpha2.ResizeDiskOperation:
+		return vra.ResizeBlockDevice(disk.ID, spec.CapacityInGB)
+	case machinev1alpha2.DetachDiskOperation:
+		return vra.DetachMachineDisk(virtualMachine.Status.Machine.ID, disk.ID)
+	case machinev1alpha2.DeleteDiskOperation:
+		return vra.DeleteBlockDevice(disk.ID)
+	}
+	return nil, fmt.Errorf("unsupported operation %q", operation)
+}
+
+// blockDeviceSpecification returns the vRA specification of a disk in the
+// spec, its block device is named after the machine and carries its
+// ownership tags
+func blockDeviceSpecification(virtualMachine *machinev1alpha2.VirtualMachine, disk *machinev1alpha2.Disk, clusterID string) *models.BlockDeviceSpecification {
+	name := fmt.Sprintf("%s-%s", virtualMachine.GetName(), disk.Name)
+	capacity := disk.CapacityInGB
+	projectID := virtualMachine.Spec.ProjectID
+	return &models.BlockDeviceSpecification{
+		Name:         &name,
+		Description:  disk.Description,
+		CapacityInGB: &capacity,
+		ProjectID:    &projectID,
+		Constraints:  expandConstraints(disk.Constraints),
+		Encrypted:    disk.Encrypted,
+		Persistent:   disk.Persistent,
+		Tags:         expandOwnershipTags(virtualMachine, clusterID),
+	}
+}
+
+// deleteDetachedDisks deletes the block devices of the disks in the status
+// that are not attached to a machine, once the machine is gone. Persistent
+// disks are left in vRA. The request of the disk being deleted is returned,
+// disks deleted straight away are forgotten.
+func deleteDetachedDisks(vra VRAClient, virtualMachine *machinev1alpha2.VirtualMachine) (*models.RequestTracker, error) {
+	for i := 0; i < len(virtualMachine.Status.Disks); {
+		disk := &virtualMachine.Status.Disks[i]
+		if disk.ID == "" || disk.Persistent || disk.State != machinev1alpha2.AvailableDiskState {
+			i++
+			continue
+		}
+		request, err := vra.DeleteBlockDevice(disk.ID)
+		if err != nil {
+			return nil, fmt.Errorf("unable to delete disk %s: %w", disk.Name, err)
+		}
+		if request != nil {
+			disk.State = machinev1alpha2.DeletingDiskState
+			return request, nil
+		}
+		removeDiskStatus(virtualMachine, disk.Name)
+	}
+	return nil, nil
+}
+
+// finishDiskOperation moves the disk in a transitional state on once its
+// request has finished
+func finishDiskOperation(virtualMachine *machinev1alpha2.VirtualMachine, tracker *models.RequestTracker) {
+	disk := pendingDisk(virtualMachine)
+	if disk == nil {
+		return
+	}
+
+	switch disk.State {
+	case machinev1alpha2.CreatingDiskState:
+		if tracker != nil && len(tracker.Resources) > 0 {
+			disk.ID = path.Base(tracker.Resources[0])
+		}
+		if spec := findDisk(virtualMachine.Spec.Disks, disk.Name); spec != nil {
+			disk.CapacityInGB = spec.CapacityInGB
+		}
+		disk.State = machinev1alpha2.AvailableDiskState
+	case machinev1alpha2.AttachingDiskState, machinev1alpha2.ResizingDiskState:
+		disk.State = machinev1alpha2.AttachedDiskState
+	case machinev1alpha2.DetachingDiskState:
+		disk.State = machinev1alpha2.AvailableDiskState
+	case machinev1alpha2.DeletingDiskState:
+		removeDiskStatus(virtualMachine, disk.Name)
+	}
+}
+
+// failDiskOperation puts the disk in a transitional state back in the state
+// it was in before the operation and records why the operation failed
+func failDiskOperation(virtualMachine *machinev1alpha2.VirtualMachine, operation machinev1alpha2.Operation, message string) {
+	if disk := pendingDisk(virtualMachine); disk != nil {
+		switch disk.State {
+		case machinev1alpha2.CreatingDiskState:
+			removeDiskStatus(virtualMachine, disk.Name)
+		case machinev1alpha2.AttachingDiskState, machinev1alpha2.DeletingDiskState:
+			disk.State = machinev1alpha2.AvailableDiskState
+		case machinev1alpha2.ResizingDiskState, machinev1alpha2.DetachingDiskState:
+			disk.State = machinev1alpha2.AttachedDiskState
+		}
+	}
+	setCondition(virtualMachine, machinev1alpha2.DisksSyncedCondition, metav1.ConditionFalse, machinev1alpha2.DiskOperationFailedReason, fmt.Sprintf("%s failed: %s", operation, message))
+}
+
+// pendingDisk returns the disk in a transitional state, if any
+func pendingDisk(virtualMachine *machinev1alpha2.VirtualMachine) *machinev1alpha2.DiskStatus {
+	for i := range virtualMachine.Status.Disks {
+		switch virtualMachine.Status.Disks[i].State {
+		case machinev1alpha2.CreatingDiskState, machinev1alpha2.AttachingDiskState, machinev1alpha2.ResizingDiskState,
+			machinev1alpha2.DetachingDiskState, machinev1alpha2.DeletingDiskState:
+			return &virtualMachine.Status.Disks[i]
+		}
+	}
+	return nil
+}
+
+func findDisk(disks []machinev1alpha2.Disk, name string) *machinev1alpha2.Disk {
+	for i := range disks {
+		if disks[i].Name == name {
+			return &disks[i]
+		}
+	}
+	return nil
+}
+
+func findDiskStatus(disks []machinev1alpha2.DiskStatus, name string) *machinev1alpha2.DiskStatus {
+	for i := range disks {
+		if disks[i].Name == name {
+			return &disks[i]
+		}
+	}
+	return nil
+}
+
+func removeDiskStatus(virtualMachine *machinev1alpha2.VirtualMachine, name string) {
+	kept := virtualMachine.Status.Disks[:0]
+	for _, disk := range virtualMachine.Status.Disks {
+		if disk.Name != name {
+			kept = append(kept, disk)
+		}
+	}
+	virtualMachine.Status.Disks = kept
+}
+
+// isDiskOperation reports whether operation works on a single disk
+func isDiskOperation(operation machinev1alpha2.Operation) bool {
+	switch operation {
+	case machinev1alpha2.CreateDiskOperation, machinev1alpha2.AttachDiskOperation, machinev1alpha2.ResizeDiskOperation,
+		machinev1alpha2.DetachDiskOperation, machinev1alpha2.DeleteDiskOperation:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	machinev1alpha2 "github.com/sammcgeown/vra/api/v1alpha2"
+)
+
+func TestDiskOperation(t *testing.T) {
+	data := machinev1alpha2.Disk{Name: "data", CapacityInGB: 10}
+	status := func(name string, capacity int32, state machinev1alpha2.DiskState, persistent bool) machinev1alpha2.DiskStatus {
+		return machinev1alpha2.DiskStatus{Name: name, ID: name + "-id", CapacityInGB: capacity, State: state, Persistent: persistent}
+	}
+
+	tests := []struct {
+		name          string
+		spec          []machinev1alpha2.Disk
+		disks         []machinev1alpha2.DiskStatus
+		machineExists bool
+		failed        bool
+		want          machinev1alpha2.Operation
+		wantStates    []machinev1alpha2.DiskState
+	}{
+		{
+			name:       "new disk",
+			spec:       []machinev1alpha2.Disk{data},
+			want:       machinev1alpha2.CreateDiskOperation,
+			wantStates: []machinev1alpha2.DiskState{machinev1alpha2.CreatingDiskState},
+		},
+		{
+			name:       "created disk before the machine exists",
+			spec:       []machinev1alpha2.Disk{data},
+			disks:      []machinev1alpha2.DiskStatus{status("data", 10, machinev1alpha2.AvailableDiskState, false)},
+			wantStates: []machinev1alpha2.DiskState{machinev1alpha2.AvailableDiskState},
+		},
+		{
+			name:          "available disk",
+			spec:          []machinev1alpha2.Disk{data},
+			disks:         []machinev1alpha2.DiskStatus{status("data", 10, machinev1alpha2.AvailableDiskState, false)},
+			machineExists: true,
+			want:          machinev1alpha2.AttachDiskOperation,
+			wantStates:    []machinev1alpha2.DiskState{machinev1alpha2.AttachingDiskState},
+		},
+		{
+			name:          "grown disk",
+			spec:          []machinev1alpha2.Disk{{Name: "data", CapacityInGB: 20}},
+			disks:         []machinev1alpha2.DiskStatus{status("data", 10, machinev1alpha2.AttachedDiskState, false)},
+			machineExists: true,
+			want:          machinev1alpha2.ResizeDiskOperation,
+			wantStates:    []machinev1alpha2.DiskState{machinev1alpha2.ResizingDiskState},
+		},
+		{
+			name:          "shrunk disk",
+			spec:          []machinev1alpha2.Disk{{Name: "data", CapacityInGB: 5}},
+			disks:         []machinev1alpha2.DiskStatus{status("data", 10, machinev1alpha2.AttachedDiskState, false)},
+			machineExists: true,
+			wantStates:    []machinev1alpha2.DiskState{machinev1alpha2.AttachedDiskState},
+		},
+		{
+			name:          "removed attached disk",
+			disks:         []machinev1alpha2.DiskStatus{status("logs", 5, machinev1alpha2.AttachedDiskState, false)},
+			machineExists: true,
+			want:          machinev1alpha2.DetachDiskOperation,
+			wantStates:    []machinev1alpha2.DiskState{machinev1alpha2.DetachingDiskState},
+		},
+		{
+			name:       "removed attached disk before the machine exists",
+			disks:      []machinev1alpha2.DiskStatus{status("logs", 5, machinev1alpha2.AttachedDiskState, false)},
+			wantStates: []machinev1alpha2.DiskState{machinev1alpha2.AttachedDiskState},
+		},
+		{
+			name:       "removed available disk",
+			disks:      []machinev1alpha2.DiskStatus{status("logs", 5, machinev1alpha2.AvailableDiskState, false)},
+			want:       machinev1alpha2.DeleteDiskOperation,
+			wantStates: []machinev1alpha2.DiskState{machinev1alpha2.DeletingDiskState},
+		},
+		{
+			name:          "removed persistent disk",
+			disks:         []machinev1alpha2.DiskStatus{status("logs", 5, machinev1alpha2.AvailableDiskState, true)},
+			machineExists: true,
+		},
+		{
+			name:          "after a failed operation",
+			spec:          []machinev1alpha2.Disk{data},
+			disks:         []machinev1alpha2.DiskStatus{status("data", 10, machinev1alpha2.AvailableDiskState, false)},
+			machineExists: true,
+			failed:        true,
+			wantStates:    []machinev1alpha2.DiskState{machinev1alpha2.AvailableDiskState},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			virtualMachine := &machinev1alpha2.VirtualMachine{
+				ObjectMeta: metav1.ObjectMeta{Generation: 1},
+				Spec:       machinev1alpha2.VirtualMachineSpec{Disks: test.spec},
+				Status:     machinev1alpha2.VirtualMachineStatus{Disks: test.disks},
+			}
+			if test.failed {
+				setCondition(virtualMachine, machinev1alpha2.DisksSyncedCondition, metav1.ConditionFalse, machinev1alpha2.DiskOperationFailedReason, "failed")
+			}
+			if got := diskOperation(virtualMachine, test.machineExists); got != test.want {
+				t.Errorf("operation = %q, want %q", got, test.want)
+			}
+			var states []machinev1alpha2.DiskState
+			for _, disk := range virtualMachine.Status.Disks {
+				states = append(states, disk.State)
+			}
+			if !reflect.DeepEqual(states, test.wantStates) {
+				t.Errorf("disk states = %v, want %v", states, test.wantStates)
+			}
+		})
+	}
+}
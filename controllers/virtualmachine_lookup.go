@@ -0,0 +1,147 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	machinev1alpha2 "github.com/sammcgeown/vra/api/v1alpha2"
+	"github.com/vmware/vra-sdk-go/pkg/models"
+)
+
+// Ownership tags, set on every machine to tie it to its VirtualMachine
+const (
+	nameTag      = "k8s_name"
+	namespaceTag = "k8s_namespace"
+	uidTag       = "k8s_uid"
+	clusterTag   = "k8s_cluster"
+)
+
+// ambiguousMachinesError is returned when more than one machine could
+// belong to the VirtualMachine
+type ambiguousMachinesError struct {
+	ids []string
+}
+
+func (e *ambiguousMachinesError) Error() string {
+	return fmt.Sprintf("found more than one machine for the VirtualMachine: %s", strings.Join(e.ids, ", "))
+}
+
+// ownershipTags returns the tags identifying the machine of virtualMachine,
+// the cluster tag is left out when no clusterID is configured
+func ownershipTags(virtualMachine *machinev1alpha2.VirtualMachine, clusterID string) map[string]string {
+	tags := map[string]string{
+		nameTag:      virtualMachine.Name,
+		namespaceTag: virtualMachine.Namespace,
+		uidTag:       string(virtualMachine.UID),
+	}
+	if clusterID != "" {
+		tags[clusterTag] = clusterID
+	}
+	return tags
+}
+
+// findMachine returns the machine of virtualMachine, nil when there is none.
+// The machine recorded in the status is looked up by its ID. Otherwise the
+// machines tagged with the name and namespace of virtualMachine, and
+// clusterID when set, are searched: machines tagged with the UID of another object are foreign and
+// returned apart, those without a UID were created before it was tagged.
+// More than one candidate is an ambiguousMachinesError.
+func findMachine(vra VRAClient, virtualMachine *machinev1alpha2.VirtualMachine, clusterID string) (*models.Machine, []string, error) {
+	if id := virtualMachine.Status.ExternalID; id != "" {
+		machine, err := vra.GetMachine(id)
+		if err != nil || machine != nil {
+			return machine, nil, err
+		}
+		// The machine was removed from vRA, look for another one
+	}
+
+	identity := ownershipTags(virtualMachine, clusterID)
+	uid := identity[uidTag]
+	delete(identity, uidTag)
+	machines, err := vra.GetMachines(identity)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var owned, untagged []*models.Machine
+	var foreign []string
+	for _, machine := range machines {
+		switch tagValue(machine.Tags, uidTag) {
+		case uid:
+			owned = append(owned, machine)
+		case "":
+			untagged = append(untagged, machine)
+		default:
+			foreign = append(foreign, *machine.ID)
+		}
+	}
+	sort.Strings(foreign)
+	candidates := owned
+	if len(candidates) == 0 {
+		candidates = untagged
+	}
+	switch len(candidates) {
+	case 0:
+		return nil, foreign, nil
+	case 1:
+		return candidates[0], foreign, nil
+	default:
+		var ids []string
+		for _, machine := range candidates {
+			ids = append(ids, *machine.ID)
+		}
+		sort.Strings(ids)
+		return nil, foreign, &ambiguousMachinesError{ids: ids}
+	}
+}
+
+// adoptMachine returns the machine named by spec.adoptMachineID once it is
+// known to be free for virtualMachine to take over: it must be in the project
+// of the spec, and neither tagged for another object nor for another cluster
+func adoptMachine(vra VRAClient, virtualMachine *machinev1alpha2.VirtualMachine, clusterID string) (*models.Machine, error) {
+	id := virtualMachine.Spec.AdoptMachineID
+	machine, err := vra.GetMachine(id)
+	if err != nil {
+		return nil, err
+	}
+	if machine == nil {
+		return nil, fmt.Errorf("machine %s does not exist", id)
+	}
+	if machine.ProjectID != virtualMachine.Spec.ProjectID {
+		return nil, fmt.Errorf("machine %s belongs to project %q, not %q", id, machine.ProjectID, virtualMachine.Spec.ProjectID)
+	}
+	if uid := tagValue(machine.Tags, uidTag); uid != "" && uid != string(virtualMachine.UID) {
+		return nil, fmt.Errorf("machine %s is managed by %s/%s", id, tagValue(machine.Tags, namespaceTag), tagValue(machine.Tags, nameTag))
+	}
+	if cluster := tagValue(machine.Tags, clusterTag); cluster != "" && cluster != clusterID {
+		return nil, fmt.Errorf("machine %s is managed by cluster %q", id, cluster)
+	}
+	return machine, nil
+}
+
+// tagValue returns the value of the tag with key, empty when there is none
+func tagValue(tags []*models.Tag, key string) string {
+	for _, tag := range tags {
+		if tag.Key != nil && *tag.Key == key && tag.Value != nil {
+			return *tag.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/vmware/vra-sdk-go/pkg/models"
+
+	machinev1alpha2 "github.com/sammcgeown/vra/api/v1alpha2"
+)
+
+// networkInterfacesLink is the machine link to its network interfaces
+const networkInterfacesLink = "network-interfaces"
+
+// expandNetworkInterfaces returns the network interfaces of the machine,
+// looking up the networks of project projectID selected by constraint tags
+func expandNetworkInterfaces(vra VRAClient, projectID string, nics []machinev1alpha2.NetworkInterface) ([]*models.NetworkInterfaceSpecification, error) {
+	var networks []*models.Network
+	var specs []*models.NetworkInterfaceSpecification
+	for i, nic := range nics {
+		networkID := nic.NetworkID
+		if networkID == "" {
+			if len(nic.Constraints) == 0 {
+				return nil, fmt.Errorf("network interface %d needs a networkId or constraints", i)
+			}
+			if networks == nil {
+				var err error
+				if networks, err = vra.GetNetworks(projectID); err != nil {
+					return nil, err
+				}
+			}
+			var err error
+			if networkID, err = selectNetwork(networks, projectID, nic.Constraints); err != nil {
+				return nil, fmt.Errorf("network interface %d: %w", i, err)
+			}
+		}
+
+		spec := &models.NetworkInterfaceSpecification{
+			Name:             nic.Name,
+			Description:      nic.Description,
+			NetworkID:        &networkID,
+			SecurityGroupIds: nic.SecurityGroupIDs,
+			DeviceIndex:      nic.DeviceIndex,
+			CustomProperties: nic.CustomProperties,
+		}
+		if nic.Address != "" {
+			spec.Addresses = []string{nic.Address}
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// selectNetwork returns the id of the network of project projectID that
+// matches every mandatory constraint and the most of the others
+func selectNetwork(networks []*models.Network, projectID string, constraints []machinev1alpha2.Constraint) (string, error) {
+	best, bestScore, tied := "", -1, false
+	for _, network := range networks {
+		// vRA rejects the networks of other projects
+		if network.ID == nil || network.ProjectID != projectID {
+			continue
+		}
+		score := 0
+		matches := true
+		for _, constraint := range constraints {
+			if matchesConstraint(network.Tags, constraint.Expression) {
+				score++
+			} else if constraint.Mandatory {
+				matches = false
+				break
+			}
+		}
+		if !matches {
+			continue
+		}
+		switch {
+		case score > bestScore:
+			best, bestScore, tied = *network.ID, score, false
+		case score == bestScore:
+			tied = true
+		}
+	}
+
+	if best == "" {
+		return "", fmt.Errorf("no network matches %s", constraintsString(constraints))
+	}
+	if tied {
+		return "", fmt.Errorf("more than one network matches %s", constraintsString(constraints))
+	}
+	return best, nil
+}
+
+// matchesConstraint reports whether tags satisfy a constraint expression,
+// either key or key:value, negated by a leading !
+func matchesConstraint(tags []*models.Tag, expression string) bool {
+	negated := strings.HasPrefix(expression, "!")
+	parts := strings.SplitN(strings.TrimPrefix(expression, "!"), ":", 2)
+	key, hasValue := parts[0], len(parts) == 2
+
+	found := false
+	for _, tag := range tags {
+		if tag.Key != nil && *tag.Key == key && (!hasValue || (tag.Value != nil && *tag.Value == parts[1])) {
+			found = true
+			break
+		}
+	}
+	return found != negated
+}
+
+func constraintsString(constraints []machinev1alpha2.Constraint) string {
+	expressions := make([]string, 0, len(constraints))
+	for _, constraint := range constraints {
+		expressions = append(expressions, constraint.Expression)
+	}
+	return "constraints " + strings.Join(expressions, ", ")
+}
+
+// observedNetworkInterfaces returns the network interfaces linked from
+// machine, ordered by device index
+func observedNetworkInterfaces(vra VRAClient, machine *models.Machine) ([]machinev1alpha2.NetworkInterfaceStatus, error) {
+	link, ok := machine.Links[networkInterfacesLink]
+	if !ok {
+		return nil, nil
+	}
+	hrefs := link.Hrefs
+	if len(hrefs) == 0 && link.Href != "" {
+		hrefs = []string{link.Href}
+	}
+
+	var nics []machinev1alpha2.NetworkInterfaceStatus
+	for _, href := range hrefs {
+		nic, err := vra.GetMachineNetworkInterface(*machine.ID, path.Base(href))
+		if err != nil {
+			return nil, err
+		}
+		status := machinev1alpha2.NetworkInterfaceStatus{
+			ID:          path.Base(href),
+			Name:        nic.Name,
+			DeviceIndex: nic.DeviceIndex,
+			Addresses:   nic.Addresses,
+		}
+		if nic.ID != nil {
+			status.ID = *nic.ID
+		}
+		nics = append(nics, status)
+	}
+	sort.SliceStable(nics, func(i, j int) bool { return nics[i].DeviceIndex < nics[j].DeviceIndex })
+	return nics, nil
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	"github.com/vmware/vra-sdk-go/pkg/models"
+
+	machinev1alpha2 "github.com/sammcgeown/vra/api/v1alpha2"
+)
+
+func newNetwork(id, projectID string, tags map[string]string) *models.Network {
+	network := &models.Network{ID: &id, ProjectID: projectID}
+	for key, value := range tags {
+		network.Tags = append(network.Tags, newTag(key, value))
+	}
+	return network
+}
+
+func TestSelectNetwork(t *testing.T) {
+	networks := []*models.Network{
+		{},
+		newNetwork("web", "project", map[string]string{"tier": "web", "zone": "a"}),
+		newNetwork("db-a", "project", map[string]string{"tier": "db", "zone": "a"}),
+		newNetwork("db-b", "project", map[string]string{"tier": "db", "zone": "b", "fast": ""}),
+		newNetwork("web-elsewhere", "other-project", map[string]string{"tier": "web", "zone": "a"}),
+		newNetwork("cache-elsewhere", "other-project", map[string]string{"tier": "cache"}),
+	}
+	mandatory := func(expression string) machinev1alpha2.Constraint {
+		return machinev1alpha2.Constraint{Mandatory: true, Expression: expression}
+	}
+	soft := func(expression string) machinev1alpha2.Constraint {
+		return machinev1alpha2.Constraint{Expression: expression}
+	}
+
+	tests := []struct {
+		name        string
+		constraints []machinev1alpha2.Constraint
+		want        string
+		wantErr     bool
+	}{
+		{"single match", []machinev1alpha2.Constraint{mandatory("tier:web")}, "web", false},
+		{"most soft matches", []machinev1alpha2.Constraint{mandatory("tier:db"), soft("zone:b")}, "db-b", false},
+		{"key only", []machinev1alpha2.Constraint{mandatory("fast")}, "db-b", false},
+		{"negated", []machinev1alpha2.Constraint{mandatory("tier:db"), mandatory("!fast")}, "db-a", false},
+		{"tied", []machinev1alpha2.Constraint{mandatory("tier:db")}, "", true},
+		{"no match", []machinev1alpha2.Constraint{mandatory("tier:queue")}, "", true},
+		{"network of another project", []machinev1alpha2.Constraint{mandatory("tier:cache")}, "", true},
+		{"soft constraints only", []machinev1alpha2.Constraint{soft("tier:web"), soft("zone:a")}, "web", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := selectNetwork(networks, "project", test.constraints)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("error = %v, want error %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("network = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
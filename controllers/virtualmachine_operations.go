@@ -0,0 +1,175 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	machinev1alpha2 "github.com/sammcgeown/vra/api/v1alpha2"
+	"github.com/vmware/vra-sdk-go/pkg/models"
+)
+
+// powerOperation returns the day-2 operation that moves a machine from the
+// observed power state towards desired, or "" when it needs none. OFF and
+// GUEST_OFF are both treated as off. A suspended machine that should be off
+// is powered off, as the guest cannot be shut down, and a machine that is off
+// has to be powered on before it can be suspended.
+func powerOperation(desired, observed machinev1alpha2.PowerState) machinev1alpha2.Operation {
+	if desired == "" || observed == "" || observed == machinev1alpha2.UnknownPowerState {
+		return ""
+	}
+
+	switch desired {
+	case machinev1alpha2.OnPowerState:
+		if observed != machinev1alpha2.OnPowerState {
+			return machinev1alpha2.PowerOnOperation
+		}
+	case machinev1alpha2.OffPowerState:
+		if observed == machinev1alpha2.OnPowerState || observed == machinev1alpha2.SuspendPowerState {
+			return machinev1alpha2.PowerOffOperation
+		}
+	case machinev1alpha2.GuestOffPowerState:
+		if observed == machinev1alpha2.OnPowerState {
+			return machinev1alpha2.ShutdownOperation
+		}
+		if observed == machinev1alpha2.SuspendPowerState {
+			return machinev1alpha2.PowerOffOperation
+		}
+	case machinev1alpha2.SuspendPowerState:
+		if observed == machinev1alpha2.OnPowerState {
+			return machinev1alpha2.SuspendOperation
+		}
+		if observed != machinev1alpha2.SuspendPowerState {
+			return machinev1alpha2.PowerOnOperation
+		}
+	}
+	return ""
+}
+
+// isPoweredOff reports whether state is one of the off power states
+func isPoweredOff(state machinev1alpha2.PowerState) bool {
+	return state == machinev1alpha2.OffPowerState || state == machinev1alpha2.GuestOffPowerState
+}
+
+// resizeOperation returns ResizeOperation when the machine needs to move to
+// the flavor in the spec. A resize that failed is not tried again until the
+// spec changes, and the condition explains why a resize is held back.
+func resizeOperation(virtualMachine *machinev1alpha2.VirtualMachine) machinev1alpha2.Operation {
+	machine := virtualMachine.Status.Machine
+	if machine.Flavor == virtualMachine.Spec.Flavor {
+		setCondition(virtualMachine, machinev1alpha2.FlavorSyncedCondition, metav1.ConditionTrue, machinev1alpha2.FlavorMatchesReason, fmt.Sprintf("machine has flavor %s", machine.Flavor))
+		return ""
+	}
+
+	condition := meta.FindStatusCondition(virtualMachine.Status.Conditions, machinev1alpha2.FlavorSyncedCondition)
+	if condition != nil && condition.Reason == machinev1alpha2.ResizeFailedReason && condition.ObservedGeneration == virtualMachine.Generation {
+		return ""
+	}
+	if virtualMachine.Spec.ResizeRequiresPowerOff && !isPoweredOff(machine.PowerState) {
+		setCondition(virtualMachine, machinev1alpha2.FlavorSyncedCondition, metav1.ConditionFalse, machinev1alpha2.PowerOffRequiredReason,
+			fmt.Sprintf("resize from %s to %s waits for the machine to be powered off", machine.Flavor, virtualMachine.Spec.Flavor))
+		return ""
+	}
+	return machinev1alpha2.ResizeOperation
+}
+
+// requestOperation submits a day-2 operation on the machine recorded in the
+// status of virtualMachine, the disks it creates are tagged with clusterID
+func requestOperation(vra VRAClient, virtualMachine *machinev1alpha2.VirtualMachine, operation machinev1alpha2.Operation, clusterID string) (*models.RequestTracker, error) {
+	if isDiskOperation(operation) {
+		return requestDiskOperation(vra, virtualMachine, operation, clusterID)
+	}
+
+	id := virtualMachine.Status.Machine.ID
+	switch operation {
+	case machinev1alpha2.PowerOnOperation:
+		return vra.PowerOnMachine(id)
+	case machinev1alpha2.PowerOffOperation:
+		return vra.PowerOffMachine(id)
+	case machinev1alpha2.ShutdownOperation:
+		return vra.ShutdownMachine(id)
+	case machinev1alpha2.SuspendOperation:
+		return vra.SuspendMachine(id)
+	case machinev1alpha2.ResizeOperation:
+		return vra.ResizeMachine(id, virtualMachine.Spec.Flavor)
+	}
+	return nil, fmt.Errorf("unsupported operation %q", operation)
+}
+
+// operationStarted records what the operation that was just submitted works
+// towards
+func operationStarted(virtualMachine *machinev1alpha2.VirtualMachine, operation machinev1alpha2.Operation) {
+	switch {
+	case operation == machinev1alpha2.ResizeOperation:
+		virtualMachine.Status.RequestedFlavor = virtualMachine.Spec.Flavor
+		setCondition(virtualMachine, machinev1alpha2.FlavorSyncedCondition, metav1.ConditionFalse, machinev1alpha2.ResizingReason, fmt.Sprintf("resizing to %s", virtualMachine.Spec.Flavor))
+	case isDiskOperation(operation):
+		if disk := pendingDisk(virtualMachine); disk != nil {
+			setCondition(virtualMachine, machinev1alpha2.DisksSyncedCondition, metav1.ConditionFalse, machinev1alpha2.UpdatingDisksReason, fmt.Sprintf("%s %s requested", operation, disk.Name))
+		}
+	}
+}
+
+// operationProgress reports the progress of the tracked operation
+func operationProgress(virtualMachine *machinev1alpha2.VirtualMachine, tracker *models.RequestTracker) {
+	done := ""
+	if tracker.Progress != nil {
+		done = fmt.Sprintf(", %d%% done", *tracker.Progress)
+	}
+
+	operation := virtualMachine.Status.Operation
+	switch {
+	case operation == machinev1alpha2.ResizeOperation:
+		setCondition(virtualMachine, machinev1alpha2.FlavorSyncedCondition, metav1.ConditionFalse, machinev1alpha2.ResizingReason, fmt.Sprintf("resizing to %s%s", virtualMachine.Status.RequestedFlavor, done))
+	case isDiskOperation(operation):
+		if disk := pendingDisk(virtualMachine); disk != nil {
+			setCondition(virtualMachine, machinev1alpha2.DisksSyncedCondition, metav1.ConditionFalse, machinev1alpha2.UpdatingDisksReason, fmt.Sprintf("%s %s in progress%s", operation, disk.Name, done))
+		}
+	}
+}
+
+// finishOperation applies the outcome of the tracked operation once its
+// request has finished, tracker is nil when it finished straight away
+func finishOperation(virtualMachine *machinev1alpha2.VirtualMachine, tracker *models.RequestTracker) {
+	operation := virtualMachine.Status.Operation
+	switch {
+	case operation == machinev1alpha2.ResizeOperation && virtualMachine.Status.Machine != nil:
+		virtualMachine.Status.Machine.Flavor = virtualMachine.Status.RequestedFlavor
+	case isDiskOperation(operation):
+		finishDiskOperation(virtualMachine, tracker)
+	}
+}
+
+// failOperation records why a day-2 operation failed
+func failOperation(virtualMachine *machinev1alpha2.VirtualMachine, operation machinev1alpha2.Operation, message string) {
+	switch {
+	case operation == machinev1alpha2.ResizeOperation:
+		setCondition(virtualMachine, machinev1alpha2.FlavorSyncedCondition, metav1.ConditionFalse, machinev1alpha2.ResizeFailedReason, fmt.Sprintf("%s failed: %s", operation, message))
+	case isDiskOperation(operation):
+		failDiskOperation(virtualMachine, operation, message)
+	}
+}
+
+// isDay2Operation reports whether operation does anything but create or
+// delete the machine. The request of one that times out is forgotten, so
+// that it can be tried again.
+func isDay2Operation(operation machinev1alpha2.Operation) bool {
+	return operation != "" && operation != machinev1alpha2.CreateOperation && operation != machinev1alpha2.DeleteOperation
+}
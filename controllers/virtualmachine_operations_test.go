@@ -0,0 +1,52 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	machinev1alpha2 "github.com/sammcgeown/vra/api/v1alpha2"
+)
+
+func TestPowerOperation(t *testing.T) {
+	tests := []struct {
+		desired, observed machinev1alpha2.PowerState
+		want              machinev1alpha2.Operation
+	}{
+		{"", machinev1alpha2.OnPowerState, ""},
+		{machinev1alpha2.OnPowerState, "", ""},
+		{machinev1alpha2.OffPowerState, machinev1alpha2.UnknownPowerState, ""},
+		{machinev1alpha2.OnPowerState, machinev1alpha2.OnPowerState, ""},
+		{machinev1alpha2.OnPowerState, machinev1alpha2.OffPowerState, machinev1alpha2.PowerOnOperation},
+		{machinev1alpha2.OnPowerState, machinev1alpha2.GuestOffPowerState, machinev1alpha2.PowerOnOperation},
+		{machinev1alpha2.OnPowerState, machinev1alpha2.SuspendPowerState, machinev1alpha2.PowerOnOperation},
+		{machinev1alpha2.OffPowerState, machinev1alpha2.OnPowerState, machinev1alpha2.PowerOffOperation},
+		{machinev1alpha2.OffPowerState, machinev1alpha2.SuspendPowerState, machinev1alpha2.PowerOffOperation},
+		{machinev1alpha2.OffPowerState, machinev1alpha2.GuestOffPowerState, ""},
+		{machinev1alpha2.GuestOffPowerState, machinev1alpha2.OnPowerState, machinev1alpha2.ShutdownOperation},
+		{machinev1alpha2.GuestOffPowerState, machinev1alpha2.SuspendPowerState, machinev1alpha2.PowerOffOperation},
+		{machinev1alpha2.GuestOffPowerState, machinev1alpha2.OffPowerState, ""},
+		{machinev1alpha2.SuspendPowerState, machinev1alpha2.OnPowerState, machinev1alpha2.SuspendOperation},
+		{machinev1alpha2.SuspendPowerState, machinev1alpha2.OffPowerState, machinev1alpha2.PowerOnOperation},
+		{machinev1alpha2.SuspendPowerState, machinev1alpha2.SuspendPowerState, ""},
+	}
+	for _, test := range tests {
+		if got := powerOperation(test.desired, test.observed); got != test.want {
+			t.Errorf("powerOperation(%q, %q) = %q, want %q", test.desired, test.observed, got, test.want)
+		}
+	}
+}
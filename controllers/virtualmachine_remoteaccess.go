@@ -0,0 +1,172 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/pkg/errors"
+	machinev1alpha2 "github.com/sammcgeown/vra/api/v1alpha2"
+	"github.com/vmware/vra-sdk-go/pkg/models"
+	"golang.org/x/crypto/ssh"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// remoteAccessPublicKeyAuthentication is the vRA authentication type
+	// installing a public key on the machine
+	remoteAccessPublicKeyAuthentication = "publicPrivateKey"
+	// remoteAccessUsernamePasswordAuthentication is the vRA authentication
+	// type setting a username and password
+	remoteAccessUsernamePasswordAuthentication = "usernamePassword"
+
+	// sshPublicKeyKey is the key of the generated public key in the private
+	// key Secret, next to corev1.SSHAuthPrivateKey
+	sshPublicKeyKey  = "ssh-publickey"
+	generatedKeyBits = 3072
+)
+
+// remoteAccess returns the remote access settings of virtualMachine, it is
+// nil when there are none. A key pair is generated on first use.
+func (r *VirtualMachineReconciler) remoteAccess(ctx context.Context, virtualMachine *machinev1alpha2.VirtualMachine) (*models.RemoteAccessSpecification, error) {
+	spec := virtualMachine.Spec.RemoteAccess
+	if spec == nil {
+		return nil, nil
+	}
+
+	switch spec.Authentication {
+	case machinev1alpha2.GeneratedKeyPairAuthentication:
+		publicKey, err := r.generatedPublicKey(ctx, virtualMachine)
+		if err != nil {
+			return nil, err
+		}
+		remoteAccess := newRemoteAccess(remoteAccessPublicKeyAuthentication)
+		remoteAccess.SSHKey = publicKey
+		return remoteAccess, nil
+	case machinev1alpha2.PublicKeyAuthentication:
+		ref := spec.PublicKeySecretRef
+		secret, err := r.remoteAccessSecret(ctx, virtualMachine.Namespace, ref.Name)
+		if err != nil {
+			return nil, err
+		}
+		publicKey, ok := secret.Data[ref.Key]
+		if !ok || len(publicKey) == 0 {
+			return nil, fmt.Errorf("remote access secret %s/%s has no key %q", virtualMachine.Namespace, ref.Name, ref.Key)
+		}
+		remoteAccess := newRemoteAccess(remoteAccessPublicKeyAuthentication)
+		remoteAccess.SSHKey = string(publicKey)
+		return remoteAccess, nil
+	case machinev1alpha2.UsernamePasswordAuthentication:
+		ref := spec.CredentialsSecretRef
+		secret, err := r.remoteAccessSecret(ctx, virtualMachine.Namespace, ref.Name)
+		if err != nil {
+			return nil, err
+		}
+		username, password := secret.Data[corev1.BasicAuthUsernameKey], secret.Data[corev1.BasicAuthPasswordKey]
+		if len(username) == 0 || len(password) == 0 {
+			return nil, fmt.Errorf("remote access secret %s/%s needs %q and %q keys", virtualMachine.Namespace, ref.Name, corev1.BasicAuthUsernameKey, corev1.BasicAuthPasswordKey)
+		}
+		remoteAccess := newRemoteAccess(remoteAccessUsernamePasswordAuthentication)
+		remoteAccess.Username, remoteAccess.Password = string(username), string(password)
+		return remoteAccess, nil
+	default:
+		return nil, fmt.Errorf("unknown remote access authentication %q", spec.Authentication)
+	}
+}
+
+func newRemoteAccess(authentication string) *models.RemoteAccessSpecification {
+	return &models.RemoteAccessSpecification{Authentication: &authentication}
+}
+
+func (r *VirtualMachineReconciler) remoteAccessSecret(ctx context.Context, namespace, name string) (*corev1.Secret, error) {
+	var secret corev1.Secret
+	if err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, &secret); err != nil {
+		return nil, errors.Wrapf(err, "unable to read remote access secret %s/%s", namespace, name)
+	}
+	return &secret, nil
+}
+
+// generatedPublicKey returns the public key of the key pair generated for
+// virtualMachine. The pair is kept in a Secret owned by the VirtualMachine,
+// so that it is generated once and removed along with the object.
+func (r *VirtualMachineReconciler) generatedPublicKey(ctx context.Context, virtualMachine *machinev1alpha2.VirtualMachine) (string, error) {
+	key := types.NamespacedName{Name: privateKeySecretName(virtualMachine), Namespace: virtualMachine.Namespace}
+	var secret corev1.Secret
+	err := r.Get(ctx, key, &secret)
+	switch {
+	case err == nil:
+		if !metav1.IsControlledBy(&secret, virtualMachine) {
+			return "", fmt.Errorf("secret %s already exists and is not owned by the VirtualMachine", key)
+		}
+		if publicKey := secret.Data[sshPublicKeyKey]; len(publicKey) > 0 {
+			return string(publicKey), nil
+		}
+		return "", fmt.Errorf("private key secret %s has no key %q", key, sshPublicKeyKey)
+	case !apierrors.IsNotFound(err):
+		return "", errors.Wrapf(err, "unable to read private key secret %s", key)
+	}
+
+	privateKey, publicKey, err := generateKeyPair()
+	if err != nil {
+		return "", errors.Wrap(err, "unable to generate a key pair")
+	}
+	secret = corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+		Type:       corev1.SecretTypeSSHAuth,
+		Data: map[string][]byte{
+			corev1.SSHAuthPrivateKey: privateKey,
+			sshPublicKeyKey:          publicKey,
+		},
+	}
+	if err := controllerutil.SetControllerReference(virtualMachine, &secret, r.Scheme); err != nil {
+		return "", err
+	}
+	if err := r.Create(ctx, &secret); err != nil {
+		return "", errors.Wrapf(err, "unable to create private key secret %s", key)
+	}
+	return string(publicKey), nil
+}
+
+// privateKeySecretName is the name of the Secret holding the key pair
+// generated for virtualMachine
+func privateKeySecretName(virtualMachine *machinev1alpha2.VirtualMachine) string {
+	return virtualMachine.Name + "-ssh-key"
+}
+
+// generateKeyPair returns a PEM encoded RSA private key and its public key
+// in authorized_keys format
+func generateKeyPair() ([]byte, []byte, error) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, generatedKeyBits)
+	if err != nil {
+		return nil, nil, err
+	}
+	publicKey, err := ssh.NewPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	privatePEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+	return privatePEM, ssh.MarshalAuthorizedKey(publicKey), nil
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"math/rand"
+	"time"
+
+	machinev1alpha1 "github.com/sammcgeown/vra/api/v1alpha1"
+	machinev1alpha2 "github.com/sammcgeown/vra/api/v1alpha2"
+	"github.com/vmware/vra-sdk-go/pkg/models"
+)
+
+// defaultMaxPollInterval is the longest wait between two checks of a request
+const defaultMaxPollInterval = 5 * time.Minute
+
+// defaultRequestTimeouts are how long the requests of each operation may run,
+// the disk operations have no timeout
+var defaultRequestTimeouts = map[machinev1alpha2.Operation]time.Duration{
+	machinev1alpha2.CreateOperation:   time.Hour,
+	machinev1alpha2.DeleteOperation:   30 * time.Minute,
+	machinev1alpha2.ResizeOperation:   30 * time.Minute,
+	machinev1alpha2.PowerOnOperation:  10 * time.Minute,
+	machinev1alpha2.PowerOffOperation: 10 * time.Minute,
+	machinev1alpha2.ShutdownOperation: 10 * time.Minute,
+	machinev1alpha2.SuspendOperation:  10 * time.Minute,
+}
+
+// RequestTimeouts returns the request timeouts per operation set in the
+// controller configuration, the power timeout applies to every power
+// operation
+func RequestTimeouts(timeouts *machinev1alpha1.RequestTimeouts) map[machinev1alpha2.Operation]time.Duration {
+	operations := map[machinev1alpha2.Operation]time.Duration{}
+	if timeouts == nil {
+		return operations
+	}
+	if timeouts.Create != nil {
+		operations[machinev1alpha2.CreateOperation] = timeouts.Create.Duration
+	}
+	if timeouts.Delete != nil {
+		operations[machinev1alpha2.DeleteOperation] = timeouts.Delete.Duration
+	}
+	if timeouts.Resize != nil {
+		operations[machinev1alpha2.ResizeOperation] = timeouts.Resize.Duration
+	}
+	if timeouts.Power != nil {
+		for _, operation := range []machinev1alpha2.Operation{
+			machinev1alpha2.PowerOnOperation,
+			machinev1alpha2.PowerOffOperation,
+			machinev1alpha2.ShutdownOperation,
+			machinev1alpha2.SuspendOperation,
+		} {
+			operations[operation] = timeouts.Power.Duration
+		}
+	}
+	return operations
+}
+
+// pollInterval returns how long to wait before checking the request of
+// virtualMachine again: as long as the request has run so far, so that the
+// wait doubles with every check, between PollInterval and MaxPollInterval.
+// The wait is spread by up to 10% so that requests submitted together are not
+// checked together.
+func (r *VirtualMachineReconciler) pollInterval(virtualMachine *machinev1alpha2.VirtualMachine) time.Duration {
+	interval := defaultRequeue
+	if r.PollInterval > 0 {
+		interval = r.PollInterval
+	}
+	maxInterval := defaultMaxPollInterval
+	if r.MaxPollInterval > 0 {
+		maxInterval = r.MaxPollInterval
+	}
+	if maxInterval < interval {
+		maxInterval = interval
+	}
+
+	if submitted := virtualMachine.Status.RequestSubmittedAt; submitted != nil && virtualMachine.Status.ExternalRequestID != "" {
+		if elapsed := time.Since(submitted.Time); elapsed > interval {
+			interval = elapsed
+		}
+	}
+	if interval > maxInterval {
+		interval = maxInterval
+	}
+	return interval + time.Duration((rand.Float64()*0.2-0.1)*float64(interval))
+}
+
+// requestTimeout returns how long the request of operation may run, 0 when it
+// has no timeout
+func (r *VirtualMachineReconciler) requestTimeout(operation machinev1alpha2.Operation) time.Duration {
+	if timeout, ok := r.RequestTimeouts[operation]; ok {
+		return timeout
+	}
+	return defaultRequestTimeouts[operation]
+}
+
+// requestTimedOut reports whether the tracked request of virtualMachine has
+// run for longer than the timeout of its operation
+func (r *VirtualMachineReconciler) requestTimedOut(virtualMachine *machinev1alpha2.VirtualMachine) bool {
+	timeout := r.requestTimeout(virtualMachine.Status.Operation)
+	submitted := virtualMachine.Status.RequestSubmittedAt
+	return timeout > 0 && submitted != nil && time.Since(submitted.Time) > timeout
+}
+
+// recordRequest records the progress and resources of the tracked request
+func recordRequest(virtualMachine *machinev1alpha2.VirtualMachine, tracker *models.RequestTracker) {
+	if tracker.Progress != nil {
+		virtualMachine.Status.RequestProgress = *tracker.Progress
+	}
+	if len(tracker.Resources) > 0 {
+		virtualMachine.Status.RequestResources = tracker.Resources
+	}
+}
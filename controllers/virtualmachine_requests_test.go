@@ -0,0 +1,120 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	machinev1alpha1 "github.com/sammcgeown/vra/api/v1alpha1"
+	machinev1alpha2 "github.com/sammcgeown/vra/api/v1alpha2"
+)
+
+func TestPollInterval(t *testing.T) {
+	submitted := func(ago time.Duration) *metav1.Time {
+		at := metav1.NewTime(time.Now().Add(-ago))
+		return &at
+	}
+
+	tests := []struct {
+		name            string
+		pollInterval    time.Duration
+		maxPollInterval time.Duration
+		requestID       string
+		submittedAt     *metav1.Time
+		want            time.Duration
+	}{
+		{name: "defaults", want: defaultRequeue},
+		{name: "no request", pollInterval: time.Second, submittedAt: submitted(time.Minute), want: time.Second},
+		{name: "new request", pollInterval: time.Second, requestID: "request", submittedAt: submitted(0), want: time.Second},
+		{name: "running request", pollInterval: time.Second, maxPollInterval: time.Minute, requestID: "request", submittedAt: submitted(10 * time.Second), want: 10 * time.Second},
+		{name: "long running request", pollInterval: time.Second, maxPollInterval: time.Minute, requestID: "request", submittedAt: submitted(time.Hour), want: time.Minute},
+		{name: "default maximum", pollInterval: time.Second, requestID: "request", submittedAt: submitted(24 * time.Hour), want: defaultMaxPollInterval},
+		{name: "maximum below the interval", pollInterval: time.Minute, maxPollInterval: time.Second, requestID: "request", submittedAt: submitted(time.Hour), want: time.Minute},
+		{name: "request without a start", pollInterval: time.Second, requestID: "request", want: time.Second},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := &VirtualMachineReconciler{PollInterval: test.pollInterval, MaxPollInterval: test.maxPollInterval}
+			virtualMachine := &machinev1alpha2.VirtualMachine{Status: machinev1alpha2.VirtualMachineStatus{
+				ExternalRequestID:  test.requestID,
+				RequestSubmittedAt: test.submittedAt,
+			}}
+			// The elapsed time grows a little while the test runs
+			low, high := test.want-test.want/10, test.want+test.want/10+time.Second/10
+			for i := 0; i < 100; i++ {
+				if got := r.pollInterval(virtualMachine); got < low || got > high {
+					t.Fatalf("pollInterval = %v, want between %v and %v", got, low, high)
+				}
+			}
+		})
+	}
+}
+
+func TestRequestTimeouts(t *testing.T) {
+	power := 2 * time.Minute
+	tests := []struct {
+		name     string
+		timeouts *machinev1alpha1.RequestTimeouts
+		want     map[machinev1alpha2.Operation]time.Duration
+	}{
+		{"none", nil, map[machinev1alpha2.Operation]time.Duration{}},
+		{
+			"create and delete",
+			&machinev1alpha1.RequestTimeouts{Create: &metav1.Duration{Duration: time.Hour}, Delete: &metav1.Duration{Duration: time.Minute}},
+			map[machinev1alpha2.Operation]time.Duration{machinev1alpha2.CreateOperation: time.Hour, machinev1alpha2.DeleteOperation: time.Minute},
+		},
+		{
+			"power",
+			&machinev1alpha1.RequestTimeouts{Power: &metav1.Duration{Duration: power}},
+			map[machinev1alpha2.Operation]time.Duration{
+				machinev1alpha2.PowerOnOperation:  power,
+				machinev1alpha2.PowerOffOperation: power,
+				machinev1alpha2.ShutdownOperation: power,
+				machinev1alpha2.SuspendOperation:  power,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := RequestTimeouts(test.timeouts); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("RequestTimeouts = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	r := &VirtualMachineReconciler{RequestTimeouts: map[machinev1alpha2.Operation]time.Duration{machinev1alpha2.ResizeOperation: time.Second}}
+	tests := []struct {
+		operation machinev1alpha2.Operation
+		want      time.Duration
+	}{
+		{machinev1alpha2.ResizeOperation, time.Second},
+		{machinev1alpha2.CreateOperation, time.Hour},
+		{machinev1alpha2.PowerOnOperation, 10 * time.Minute},
+		{machinev1alpha2.AttachDiskOperation, 0},
+	}
+	for _, test := range tests {
+		if got := r.requestTimeout(test.operation); got != test.want {
+			t.Errorf("requestTimeout(%q) = %v, want %v", test.operation, got, test.want)
+		}
+	}
+}
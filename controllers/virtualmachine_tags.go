@@ -0,0 +1,142 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	machinev1alpha2 "github.com/sammcgeown/vra/api/v1alpha2"
+	"github.com/vmware/vra-sdk-go/pkg/models"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// desiredTags returns the tags the machine of virtualMachine carries: the
+// tags in the spec and the ones the controller finds the machine by
+func desiredTags(virtualMachine *machinev1alpha2.VirtualMachine, clusterID string) []*models.Tag {
+	return append(expandTags(virtualMachine.Spec.Tags), expandOwnershipTags(virtualMachine, clusterID)...)
+}
+
+// expandOwnershipTags returns the ownership tags of virtualMachine in a fixed
+// order
+func expandOwnershipTags(virtualMachine *machinev1alpha2.VirtualMachine, clusterID string) []*models.Tag {
+	identity := ownershipTags(virtualMachine, clusterID)
+	var tags []*models.Tag
+	for _, key := range []string{nameTag, namespaceTag, uidTag, clusterTag} {
+		if value, ok := identity[key]; ok {
+			tags = append(tags, newTag(key, value))
+		}
+	}
+	return tags
+}
+
+func newTag(key, value string) *models.Tag {
+	return &models.Tag{Key: &key, Value: &value}
+}
+
+// syncTags re-applies the desired tags when the tags of machine differ from
+// them, keeping the tags with keys the controller does not manage
+func syncTags(vra VRAClient, virtualMachine *machinev1alpha2.VirtualMachine, machine *models.Machine, clusterID string) error {
+	desired := desiredTags(virtualMachine, clusterID)
+	tags, drifted := syncedTags(desired, virtualMachine.Status.ManagedTagKeys, machine.Tags)
+	if len(drifted) == 0 {
+		virtualMachine.Status.ManagedTagKeys = tagKeys(desired)
+		// Keep reporting the last drift until the spec changes
+		condition := meta.FindStatusCondition(virtualMachine.Status.Conditions, machinev1alpha2.TagsSyncedCondition)
+		if condition == nil || condition.Reason != machinev1alpha2.TagsReappliedReason || condition.ObservedGeneration != virtualMachine.Generation {
+			setCondition(virtualMachine, machinev1alpha2.TagsSyncedCondition, metav1.ConditionTrue, machinev1alpha2.TagsMatchReason, "machine carries the tags in the spec")
+		}
+		return nil
+	}
+
+	if _, err := vra.UpdateMachine(*machine.ID, &models.UpdateMachineSpecification{Tags: tags}); err != nil {
+		setCondition(virtualMachine, machinev1alpha2.TagsSyncedCondition, metav1.ConditionFalse, machinev1alpha2.TagUpdateFailedReason, fmt.Sprintf("tags %s differ from the spec: %v", strings.Join(drifted, ", "), err))
+		return err
+	}
+	message := fmt.Sprintf("tags %s were changed in vRealize Automation and have been re-applied", strings.Join(drifted, ", "))
+	if condition := meta.FindStatusCondition(virtualMachine.Status.Conditions, machinev1alpha2.TagsSyncedCondition); condition != nil && condition.ObservedGeneration != virtualMachine.Generation {
+		message = fmt.Sprintf("tags %s have been updated to match the spec", strings.Join(drifted, ", "))
+	}
+	machine.Tags = tags
+	virtualMachine.Status.ManagedTagKeys = tagKeys(desired)
+	setCondition(virtualMachine, machinev1alpha2.TagsSyncedCondition, metav1.ConditionTrue, machinev1alpha2.TagsReappliedReason, message)
+	return nil
+}
+
+// syncedTags returns the tags the machine should carry, the desired tags
+// followed by the current tags whose keys are neither desired nor managed.
+// The managed keys whose values differ from the desired ones are returned as
+// well, none when the tags match.
+func syncedTags(desired []*models.Tag, managedKeys []string, current []*models.Tag) ([]*models.Tag, []string) {
+	managed := map[string]bool{}
+	for _, key := range managedKeys {
+		managed[key] = true
+	}
+	for _, tag := range desired {
+		managed[*tag.Key] = true
+	}
+
+	tags := append([]*models.Tag{}, desired...)
+	for _, tag := range current {
+		if tag.Key != nil && !managed[*tag.Key] {
+			tags = append(tags, tag)
+		}
+	}
+
+	want, have := tagValues(desired), tagValues(current)
+	var drifted []string
+	for key := range managed {
+		if want[key] != have[key] {
+			drifted = append(drifted, key)
+		}
+	}
+	sort.Strings(drifted)
+	return tags, drifted
+}
+
+// tagValues returns the sorted values of each tag key, joined by commas
+func tagValues(tags []*models.Tag) map[string]string {
+	values := map[string][]string{}
+	for _, tag := range tags {
+		if tag.Key == nil {
+			continue
+		}
+		value := ""
+		if tag.Value != nil {
+			value = *tag.Value
+		}
+		values[*tag.Key] = append(values[*tag.Key], value)
+	}
+	joined := make(map[string]string, len(values))
+	for key, list := range values {
+		sort.Strings(list)
+		joined[key] = strings.Join(list, ",")
+	}
+	return joined
+}
+
+// tagKeys returns the sorted distinct keys of tags
+func tagKeys(tags []*models.Tag) []string {
+	var keys []string
+	for key := range tagValues(tags) {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
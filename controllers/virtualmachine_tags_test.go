@@ -0,0 +1,97 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/vmware/vra-sdk-go/pkg/models"
+)
+
+// tagList returns tags as key:value pairs in their order
+func tagList(tags []*models.Tag) []string {
+	list := []string{}
+	for _, tag := range tags {
+		list = append(list, *tag.Key+":"+*tag.Value)
+	}
+	return list
+}
+
+func TestSyncedTags(t *testing.T) {
+	tests := []struct {
+		name        string
+		desired     []*models.Tag
+		managedKeys []string
+		current     []*models.Tag
+		wantTags    []string
+		wantDrifted []string
+	}{
+		{
+			name:     "matching tags",
+			desired:  []*models.Tag{newTag("env", "prod")},
+			current:  []*models.Tag{newTag("env", "prod"), newTag("owner", "ops")},
+			wantTags: []string{"env:prod", "owner:ops"},
+		},
+		{
+			name:        "changed value",
+			desired:     []*models.Tag{newTag("env", "prod")},
+			current:     []*models.Tag{newTag("owner", "ops"), newTag("env", "dev")},
+			wantTags:    []string{"env:prod", "owner:ops"},
+			wantDrifted: []string{"env"},
+		},
+		{
+			name:        "missing tag",
+			desired:     []*models.Tag{newTag("env", "prod"), newTag("tier", "web")},
+			current:     []*models.Tag{newTag("env", "prod")},
+			wantTags:    []string{"env:prod", "tier:web"},
+			wantDrifted: []string{"tier"},
+		},
+		{
+			name:        "managed tag dropped from the spec",
+			desired:     []*models.Tag{newTag("env", "prod")},
+			managedKeys: []string{"env", "team"},
+			current:     []*models.Tag{newTag("env", "prod"), newTag("team", "a"), newTag("owner", "ops")},
+			wantTags:    []string{"env:prod", "owner:ops"},
+			wantDrifted: []string{"team"},
+		},
+		{
+			name:        "extra value for a managed key",
+			desired:     []*models.Tag{newTag("env", "prod")},
+			current:     []*models.Tag{newTag("env", "prod"), newTag("env", "dev")},
+			wantTags:    []string{"env:prod"},
+			wantDrifted: []string{"env"},
+		},
+		{
+			name:     "tag without a key",
+			desired:  []*models.Tag{newTag("env", "prod")},
+			current:  []*models.Tag{{}, newTag("env", "prod")},
+			wantTags: []string{"env:prod"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tags, drifted := syncedTags(test.desired, test.managedKeys, test.current)
+			if got := tagList(tags); !reflect.DeepEqual(got, test.wantTags) {
+				t.Errorf("tags = %v, want %v", got, test.wantTags)
+			}
+			if !reflect.DeepEqual(drifted, test.wantDrifted) {
+				t.Errorf("drifted = %v, want %v", drifted, test.wantDrifted)
+			}
+		})
+	}
+}
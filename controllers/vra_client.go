@@ -0,0 +1,342 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-openapi/runtime"
+	"github.com/go-openapi/strfmt"
+	vraclient "github.com/vmware/vra-sdk-go/pkg/client"
+	"github.com/vmware/vra-sdk-go/pkg/client/compute"
+	"github.com/vmware/vra-sdk-go/pkg/client/disk"
+	"github.com/vmware/vra-sdk-go/pkg/client/network"
+	"github.com/vmware/vra-sdk-go/pkg/client/request"
+	"github.com/vmware/vra-sdk-go/pkg/models"
+)
+
+// VRAClient is the part of the vRA IaaS API used by the controllers.
+// Operations that run asynchronously in vRA return the RequestTracker that
+// follows their progress.
+type VRAClient interface {
+	// GetMachines returns the machines carrying all of the given tags
+	GetMachines(tags map[string]string) ([]*models.Machine, error)
+	// GetMachine returns the machine with id, nil when there is none
+	GetMachine(id string) (*models.Machine, error)
+	CreateMachine(spec *models.MachineSpecification) (*models.RequestTracker, error)
+	// DeleteMachine returns the request deleting the machine with id, nil
+	// when there is no such machine
+	DeleteMachine(id string) (*models.RequestTracker, error)
+	// UpdateMachine changes the tags, description or custom properties of a
+	// machine, vRA applies the update straight away
+	UpdateMachine(id string, spec *models.UpdateMachineSpecification) (*models.Machine, error)
+
+	// Day-2 power operations
+	PowerOnMachine(id string) (*models.RequestTracker, error)
+	PowerOffMachine(id string) (*models.RequestTracker, error)
+	ShutdownMachine(id string) (*models.RequestTracker, error)
+	SuspendMachine(id string) (*models.RequestTracker, error)
+	// ResizeMachine changes the flavor of a machine
+	ResizeMachine(id, flavor string) (*models.RequestTracker, error)
+
+	// GetMachineDisks returns the block devices attached to a machine
+	GetMachineDisks(machineID string) ([]*models.BlockDevice, error)
+	CreateBlockDevice(spec *models.BlockDeviceSpecification) (*models.RequestTracker, error)
+	AttachMachineDisk(machineID, blockDeviceID, name string) (*models.RequestTracker, error)
+	DetachMachineDisk(machineID, blockDeviceID string) (*models.RequestTracker, error)
+	ResizeBlockDevice(id string, capacityInGB int32) (*models.RequestTracker, error)
+	// DeleteBlockDevice returns a nil RequestTracker when the block device
+	// was deleted straight away
+	DeleteBlockDevice(id string) (*models.RequestTracker, error)
+
+	// GetNetworks returns the networks of the project with projectID
+	GetNetworks(projectID string) ([]*models.Network, error)
+	GetMachineNetworkInterface(machineID, id string) (*models.NetworkInterface, error)
+
+	GetRequestTracker(id string) (*models.RequestTracker, error)
+}
+
+// pageSize is the number of elements read per call when listing
+const pageSize = 100
+
+// sdkVRAClient implements VRAClient with the vra-sdk-go client
+type sdkVRAClient struct {
+	api *vraclient.MulticloudIaaS
+}
+
+// NewVRAClient returns a VRAClient backed by api
+func NewVRAClient(api *vraclient.MulticloudIaaS) VRAClient {
+	return &sdkVRAClient{api: api}
+}
+
+func (c *sdkVRAClient) GetMachines(tags map[string]string) ([]*models.Machine, error) {
+	filter := tagFilter(tags)
+	top := int64(pageSize)
+	var matched []*models.Machine
+	for skip := int64(0); ; {
+		machines, err := c.api.Compute.GetMachines(compute.NewGetMachinesParams().
+			WithDollarFilter(&filter).WithDollarSkip(&skip).WithDollarTop(&top))
+		if err != nil {
+			return nil, err
+		}
+		// The filter does not tie each key to its value, so check the matches
+		for _, machine := range machines.Payload.Content {
+			if hasTags(machine.Tags, tags) {
+				matched = append(matched, machine)
+			}
+		}
+		skip += int64(len(machines.Payload.Content))
+		if len(machines.Payload.Content) == 0 || skip >= machines.Payload.TotalElements {
+			return matched, nil
+		}
+	}
+}
+
+func (c *sdkVRAClient) GetMachine(id string) (*models.Machine, error) {
+	machine, err := c.api.Compute.GetMachine(compute.NewGetMachineParams().WithID(id))
+	if _, ok := err.(*compute.GetMachineNotFound); ok {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return machine.Payload, nil
+}
+
+func (c *sdkVRAClient) CreateMachine(spec *models.MachineSpecification) (*models.RequestTracker, error) {
+	created, err := c.api.Compute.CreateMachine(compute.NewCreateMachineParams().WithBody(spec))
+	if err != nil {
+		return nil, err
+	}
+	return created.Payload, nil
+}
+
+func (c *sdkVRAClient) DeleteMachine(id string) (*models.RequestTracker, error) {
+	deleted, err := c.api.Compute.DeleteMachine(compute.NewDeleteMachineParams().WithID(id))
+	if isNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return deleted.Payload, nil
+}
+
+func (c *sdkVRAClient) UpdateMachine(id string, spec *models.UpdateMachineSpecification) (*models.Machine, error) {
+	updated, err := c.api.Compute.UpdateMachine(compute.NewUpdateMachineParams().WithID(id).WithBody(spec))
+	if err != nil {
+		return nil, err
+	}
+	return updated.Payload, nil
+}
+
+func (c *sdkVRAClient) PowerOnMachine(id string) (*models.RequestTracker, error) {
+	accepted, err := c.api.Compute.PowerOnMachine(compute.NewPowerOnMachineParams().WithID(id))
+	if err != nil {
+		return nil, err
+	}
+	return accepted.Payload, nil
+}
+
+func (c *sdkVRAClient) PowerOffMachine(id string) (*models.RequestTracker, error) {
+	accepted, err := c.api.Compute.PowerOffMachine(compute.NewPowerOffMachineParams().WithID(id))
+	if err != nil {
+		return nil, err
+	}
+	return accepted.Payload, nil
+}
+
+func (c *sdkVRAClient) ShutdownMachine(id string) (*models.RequestTracker, error) {
+	accepted, err := c.api.Compute.ShutdownMachine(compute.NewShutdownMachineParams().WithID(id))
+	if err != nil {
+		return nil, err
+	}
+	return accepted.Payload, nil
+}
+
+func (c *sdkVRAClient) SuspendMachine(id string) (*models.RequestTracker, error) {
+	accepted, err := c.api.Compute.SuspendMachine(compute.NewSuspendMachineParams().WithID(id))
+	if err != nil {
+		return nil, err
+	}
+	return accepted.Payload, nil
+}
+
+func (c *sdkVRAClient) ResizeMachine(id, flavor string) (*models.RequestTracker, error) {
+	accepted, err := c.api.Compute.ResizeMachine(compute.NewResizeMachineParams().WithID(id).WithName(&flavor))
+	if err != nil {
+		return nil, err
+	}
+	return accepted.Payload, nil
+}
+
+func (c *sdkVRAClient) GetMachineDisks(machineID string) ([]*models.BlockDevice, error) {
+	disks, err := c.api.Disk.GetMachineDisks(disk.NewGetMachineDisksParams().WithID(machineID))
+	if err != nil {
+		return nil, err
+	}
+	return disks.Payload.Content, nil
+}
+
+func (c *sdkVRAClient) CreateBlockDevice(spec *models.BlockDeviceSpecification) (*models.RequestTracker, error) {
+	created, err := c.api.Disk.CreateBlockDevice(disk.NewCreateBlockDeviceParams().WithBody(spec))
+	if err != nil {
+		return nil, err
+	}
+	return created.Payload, nil
+}
+
+func (c *sdkVRAClient) AttachMachineDisk(machineID, blockDeviceID, name string) (*models.RequestTracker, error) {
+	attached, err := c.api.Disk.AttachMachineDisk(disk.NewAttachMachineDiskParams().WithID(machineID).WithBody(&models.DiskAttachmentSpecification{
+		BlockDeviceID: &blockDeviceID,
+		Name:          name,
+	}))
+	if err != nil {
+		return nil, err
+	}
+	return attached.Payload, nil
+}
+
+func (c *sdkVRAClient) DetachMachineDisk(machineID, blockDeviceID string) (*models.RequestTracker, error) {
+	detached, err := c.api.Disk.DeleteMachineDisk(disk.NewDeleteMachineDiskParams().WithID(machineID).WithId1(blockDeviceID))
+	if err != nil {
+		return nil, err
+	}
+	return detached.Payload, nil
+}
+
+func (c *sdkVRAClient) ResizeBlockDevice(id string, capacityInGB int32) (*models.RequestTracker, error) {
+	accepted, _, err := c.api.Disk.ResizeBlockDevice(disk.NewResizeBlockDeviceParams().WithID(id).WithCapacityInGB(capacityInGB))
+	if err != nil {
+		return nil, err
+	}
+	if accepted == nil {
+		return nil, fmt.Errorf("block device %s already has %d GB", id, capacityInGB)
+	}
+	return accepted.Payload, nil
+}
+
+func (c *sdkVRAClient) DeleteBlockDevice(id string) (*models.RequestTracker, error) {
+	accepted, _, err := c.api.Disk.DeleteBlockDevice(disk.NewDeleteBlockDeviceParams().WithID(id))
+	if err != nil {
+		return nil, err
+	}
+	if accepted == nil {
+		return nil, nil
+	}
+	return accepted.Payload, nil
+}
+
+func (c *sdkVRAClient) GetNetworks(projectID string) ([]*models.Network, error) {
+	filter := "projectId eq '" + odataEscape(projectID) + "'"
+	var all []*models.Network
+	for {
+		networks, err := c.api.Network.GetNetworks(network.NewGetNetworksParams(), withQuery(filter, len(all), pageSize))
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, networks.Payload.Content...)
+		if len(networks.Payload.Content) == 0 || int64(len(all)) >= networks.Payload.TotalElements {
+			return all, nil
+		}
+	}
+}
+
+// withQuery asks a networks call for the page of up to top elements matching
+// filter after the first skip, the generated parameters have no filter or
+// paging fields
+func withQuery(filter string, skip, top int) network.ClientOption {
+	return func(op *runtime.ClientOperation) {
+		params := op.Params
+		op.Params = runtime.ClientRequestWriterFunc(func(req runtime.ClientRequest, reg strfmt.Registry) error {
+			if err := req.SetQueryParam("$filter", filter); err != nil {
+				return err
+			}
+			if err := req.SetQueryParam("$skip", strconv.Itoa(skip)); err != nil {
+				return err
+			}
+			if err := req.SetQueryParam("$top", strconv.Itoa(top)); err != nil {
+				return err
+			}
+			return params.WriteToRequest(req, reg)
+		})
+	}
+}
+
+func (c *sdkVRAClient) GetMachineNetworkInterface(machineID, id string) (*models.NetworkInterface, error) {
+	nic, err := c.api.Network.GetMachineNetworkInterface(network.NewGetMachineNetworkInterfaceParams().WithID(machineID).WithId1(id))
+	if err != nil {
+		return nil, err
+	}
+	return nic.Payload, nil
+}
+
+func (c *sdkVRAClient) GetRequestTracker(id string) (*models.RequestTracker, error) {
+	requestTracker, err := c.api.Request.GetRequestTracker(request.NewGetRequestTrackerParams().WithID(id))
+	if err != nil {
+		return nil, err
+	}
+	return requestTracker.Payload, nil
+}
+
+// tagFilter returns an OData $filter matching machines with all of tags
+func tagFilter(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	clauses := make([]string, 0, len(keys))
+	for _, key := range keys {
+		clauses = append(clauses, "tags.item.key eq '"+odataEscape(key)+"' and tags.item.value eq '"+odataEscape(tags[key])+"'")
+	}
+	return strings.Join(clauses, " and ")
+}
+
+// hasTags reports whether all of want are present in tags
+func hasTags(tags []*models.Tag, want map[string]string) bool {
+	for key, value := range want {
+		found := false
+		for _, tag := range tags {
+			if tag.Key != nil && tag.Value != nil && *tag.Key == key && *tag.Value == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// odataEscape quotes s for use in an OData string literal
+func odataEscape(s string) string {
+	return strings.ReplaceAll(s, "'", "''")
+}
+
+// isNotFound reports whether err is a 404 response of an endpoint the SDK
+// declares no not found response for
+func isNotFound(err error) bool {
+	apiErr, ok := err.(*runtime.APIError)
+	return ok && apiErr.Code == http.StatusNotFound
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/sammcgeown/vra/pkg/vra"
+	"github.com/sammcgeown/vra/pkg/vrasim"
+	"github.com/vmware/vra-sdk-go/pkg/models"
+)
+
+func TestTagFilter(t *testing.T) {
+	tests := []struct {
+		tags map[string]string
+		want string
+	}{
+		{nil, ""},
+		{map[string]string{"k8s_name": "web"}, "tags.item.key eq 'k8s_name' and tags.item.value eq 'web'"},
+		{
+			map[string]string{"k8s_namespace": "default", "k8s_name": "web"},
+			"tags.item.key eq 'k8s_name' and tags.item.value eq 'web' and tags.item.key eq 'k8s_namespace' and tags.item.value eq 'default'",
+		},
+		{map[string]string{"owner": "o'brien"}, "tags.item.key eq 'owner' and tags.item.value eq 'o''brien'"},
+	}
+	for _, test := range tests {
+		if got := tagFilter(test.tags); got != test.want {
+			t.Errorf("tagFilter(%v) = %q, want %q", test.tags, got, test.want)
+		}
+	}
+}
+
+func TestGetMachinesPages(t *testing.T) {
+	server := vrasim.NewServer(vrasim.Options{RefreshToken: "refresh", PageSize: 2})
+	defer server.Close()
+	api, err := vra.NewClient(vra.Config{URL: server.URL, RefreshToken: "refresh"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag := func(key, value string) *models.Tag {
+		return &models.Tag{Key: &key, Value: &value}
+	}
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		server.AddMachine(&models.Machine{Name: name, Tags: []*models.Tag{tag(nameTag, "web"), tag(namespaceTag, "default")}})
+	}
+	server.AddMachine(&models.Machine{Name: "f", Tags: []*models.Tag{tag(nameTag, "web"), tag(namespaceTag, "other")}})
+
+	machines, err := NewVRAClient(api).GetMachines(map[string]string{nameTag: "web", namespaceTag: "default"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, machine := range machines {
+		names = append(names, machine.Name)
+	}
+	sort.Strings(names)
+	if want := []string{"a", "b", "c", "d", "e"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("GetMachines() = %v, want %v", names, want)
+	}
+}
+
+func TestGetNetworksPages(t *testing.T) {
+	server := vrasim.NewServer(vrasim.Options{RefreshToken: "refresh", PageSize: 2})
+	defer server.Close()
+	api, err := vra.NewClient(vra.Config{URL: server.URL, RefreshToken: "refresh"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b", "c", "d"} {
+		server.AddNetwork(&models.Network{Name: name, ProjectID: "project"})
+	}
+	server.AddNetwork(&models.Network{Name: "e", ProjectID: "other-project"})
+
+	networks, err := NewVRAClient(api).GetNetworks("project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, network := range networks {
+		names = append(names, network.Name)
+	}
+	sort.Strings(names)
+	if want := []string{"a", "b", "c", "d"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("GetNetworks() = %v, want %v", names, want)
+	}
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/sammcgeown/vra/pkg/vra"
+)
+
+// DefaultVRAClient is the name of the client built from the ProjectConfig
+const DefaultVRAClient = "default"
+
+// EndpointVRAClient returns the name of the client built from a VRAEndpoint
+func EndpointVRAClient(endpoint string) string {
+	return "endpoint/" + endpoint
+}
+
+// VRAClientCache holds the vRA clients used by the controllers, keyed by name.
+// A client is rebuilt whenever the configuration it was built from changes.
+type VRAClientCache struct {
+	mu      sync.RWMutex
+	clients map[string]cachedVRAClient
+}
+
+type cachedVRAClient struct {
+	client   VRAClient
+	checksum string
+	err      error
+}
+
+// NewVRAClientCache returns an empty VRAClientCache
+func NewVRAClientCache() *VRAClientCache {
+	return &VRAClientCache{clients: map[string]cachedVRAClient{}}
+}
+
+// Get returns the named client, or the reason it is unavailable
+func (c *VRAClientCache) Get(name string) (VRAClient, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	cached, ok := c.clients[name]
+	if !ok {
+		return nil, fmt.Errorf("vRA client %q has not been configured", name)
+	}
+	if cached.err != nil {
+		return nil, cached.err
+	}
+	return cached.client, nil
+}
+
+// Set stores a client that was built elsewhere
+func (c *VRAClientCache) Set(name string, client VRAClient) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.clients[name] = cachedVRAClient{client: client}
+}
+
+// Update rebuilds the named client if cfg differs from the configuration it
+// was last built from. It reports whether a new client was built; on error
+// the client is marked unavailable until the next successful update.
+func (c *VRAClientCache) Update(name string, cfg vra.Config) (bool, error) {
+	checksum, err := configChecksum(cfg)
+	if err != nil {
+		return false, err
+	}
+
+	c.mu.RLock()
+	cached, ok := c.clients[name]
+	c.mu.RUnlock()
+	if ok && cached.checksum == checksum && cached.err == nil {
+		return false, nil
+	}
+
+	var client VRAClient
+	api, err := vra.NewClient(cfg)
+	if err == nil {
+		client = NewVRAClient(api)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.clients[name] = cachedVRAClient{client: client, checksum: checksum, err: err}
+	return err == nil, err
+}
+
+// Remove forgets the named client
+func (c *VRAClientCache) Remove(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.clients, name)
+}
+
+// Invalidate marks the named client as unavailable
+func (c *VRAClientCache) Invalidate(name string, reason error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.clients[name] = cachedVRAClient{err: reason}
+}
+
+// configChecksum identifies a configuration without keeping the credentials
+// it contains in memory any longer than needed.
+func configChecksum(cfg vra.Config) (string, error) {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data)), nil
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	machinev1alpha1 "github.com/sammcgeown/vra/api/v1alpha1"
+	"github.com/sammcgeown/vra/pkg/vra"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// VRAEndpointReconciler reconciles a VRAEndpoint object, keeping a logged in
+// vRA client for each endpoint in Clients.
+type VRAEndpointReconciler struct {
+	client.Client
+	Log      logr.Logger
+	Recorder record.EventRecorder
+	Clients  *VRAClientCache
+}
+
+//+kubebuilder:rbac:groups=machine.cmbu.local,resources=vraendpoints,verbs=get;list;watch
+//+kubebuilder:rbac:groups=machine.cmbu.local,resources=vraendpoints/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
+// Reconcile logs in to the vRA instance described by the VRAEndpoint and
+// reports the outcome in its Ready condition.
+func (r *VRAEndpointReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("vraendpoint", req.Name)
+
+	var endpoint machinev1alpha1.VRAEndpoint
+	if err := r.Get(ctx, req.NamespacedName, &endpoint); err != nil {
+		if apierrors.IsNotFound(err) {
+			r.Clients.Remove(EndpointVRAClient(req.Name))
+			return ctrl.Result{}, nil
+		}
+		log.Error(err, "unable to fetch VRAEndpoint")
+		return ctrl.Result{}, err
+	}
+
+	result := ctrl.Result{}
+	cfg, err := r.endpointConfig(ctx, &endpoint)
+	if err != nil {
+		r.Clients.Invalidate(EndpointVRAClient(endpoint.Name), err)
+		r.setReady(&endpoint, metav1.ConditionFalse, machinev1alpha1.CredentialsNotFoundReason, err.Error())
+		result.RequeueAfter = credentialsRetry
+	} else if _, err := r.Clients.Update(EndpointVRAClient(endpoint.Name), cfg); err != nil {
+		log.Error(err, "unable to log in to vRealize Automation")
+		r.setReady(&endpoint, metav1.ConditionFalse, machinev1alpha1.LoginFailedReason, err.Error())
+		result.RequeueAfter = credentialsRetry
+	} else {
+		r.setReady(&endpoint, metav1.ConditionTrue, machinev1alpha1.LoginSucceededReason, "logged in to vRealize Automation")
+	}
+
+	endpoint.Status.ObservedGeneration = endpoint.Generation
+	return result, errors.Wrap(r.Status().Update(ctx, &endpoint), "could not update status")
+}
+
+// endpointConfig reads the credentials of endpoint into a client configuration
+func (r *VRAEndpointReconciler) endpointConfig(ctx context.Context, endpoint *machinev1alpha1.VRAEndpoint) (vra.Config, error) {
+	ref := endpoint.Spec.CredentialsSecretRef
+	var secret corev1.Secret
+	if err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: ref.Namespace}, &secret); err != nil {
+		return vra.Config{}, errors.Wrapf(err, "unable to read credentials secret %s/%s", ref.Namespace, ref.Name)
+	}
+	credential, ok := secret.Data[ref.Key]
+	if !ok || len(credential) == 0 {
+		return vra.Config{}, fmt.Errorf("credentials secret %s/%s has no key %q", ref.Namespace, ref.Name, ref.Key)
+	}
+
+	cfg := vra.Config{
+		URL:      endpoint.Spec.URL,
+		AuthMode: vra.AuthMode(endpoint.Spec.AuthMode),
+		Username: endpoint.Spec.Username,
+		Domain:   endpoint.Spec.Domain,
+	}
+	setCredential(&cfg, string(credential))
+	return cfg, ApplyTLSConfig(ctx, r, endpoint.Spec.TLS, &cfg)
+}
+
+// setReady records the Ready condition, with an event when it changes
+func (r *VRAEndpointReconciler) setReady(endpoint *machinev1alpha1.VRAEndpoint, status metav1.ConditionStatus, reason, message string) {
+	if !meta.IsStatusConditionPresentAndEqual(endpoint.Status.Conditions, machinev1alpha1.ReadyCondition, status) {
+		eventType := corev1.EventTypeNormal
+		if status != metav1.ConditionTrue {
+			eventType = corev1.EventTypeWarning
+		}
+		r.Recorder.Event(endpoint, eventType, reason, message)
+	}
+	meta.SetStatusCondition(&endpoint.Status.Conditions, metav1.Condition{
+		Type:               machinev1alpha1.ReadyCondition,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: endpoint.Generation,
+	})
+}
+
+// endpointsForSecret maps a Secret to the VRAEndpoints that use it
+func (r *VRAEndpointReconciler) endpointsForSecret(object client.Object) []reconcile.Request {
+	return r.endpointsFor(object, func(endpoint *machinev1alpha1.VRAEndpoint) bool {
+		ref := endpoint.Spec.CredentialsSecretRef
+		return (ref.Name == object.GetName() && ref.Namespace == object.GetNamespace()) ||
+			tlsReferences(endpoint.Spec.TLS, "Secret", object)
+	})
+}
+
+// endpointsForConfigMap maps a ConfigMap to the VRAEndpoints that use it
+func (r *VRAEndpointReconciler) endpointsForConfigMap(object client.Object) []reconcile.Request {
+	return r.endpointsFor(object, func(endpoint *machinev1alpha1.VRAEndpoint) bool {
+		return tlsReferences(endpoint.Spec.TLS, "ConfigMap", object)
+	})
+}
+
+func (r *VRAEndpointReconciler) endpointsFor(object client.Object, uses func(*machinev1alpha1.VRAEndpoint) bool) []reconcile.Request {
+	var endpoints machinev1alpha1.VRAEndpointList
+	if err := r.List(context.Background(), &endpoints); err != nil {
+		r.Log.Error(err, "unable to list VRAEndpoints")
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for i := range endpoints.Items {
+		if uses(&endpoints.Items[i]) {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: endpoints.Items[i].Name}})
+		}
+	}
+	return requests
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *VRAEndpointReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&machinev1alpha1.VRAEndpoint{}).
+		Watches(&source.Kind{Type: &corev1.Secret{}}, handler.EnqueueRequestsFromMapFunc(r.endpointsForSecret)).
+		Watches(&source.Kind{Type: &corev1.ConfigMap{}}, handler.EnqueueRequestsFromMapFunc(r.endpointsForConfigMap)).
+		Complete(r)
+}
@@ -10,6 +10,8 @@ require (
 	github.com/onsi/gomega v1.15.0
 	github.com/pkg/errors v0.9.1
 	github.com/vmware/vra-sdk-go v0.3.0
+	golang.org/x/crypto v0.0.0-20210220033148-5ea612d1eb83
+	k8s.io/api v0.22.1
 	k8s.io/apimachinery v0.22.1
 	k8s.io/client-go v0.22.1
 	sigs.k8s.io/controller-runtime v0.10.0
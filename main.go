@@ -17,24 +17,19 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
-	"net/http"
-	neturl "net/url"
 	"os"
-	"strings"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
-	httptransport "github.com/go-openapi/runtime/client"
-	"github.com/go-openapi/strfmt"
 	machinev1alpha1 "github.com/sammcgeown/vra/api/v1alpha1"
+	machinev1alpha2 "github.com/sammcgeown/vra/api/v1alpha2"
 
 	"github.com/sammcgeown/vra/controllers"
-	vraclient "github.com/vmware/vra-sdk-go/pkg/client"
-	"github.com/vmware/vra-sdk-go/pkg/client/login"
-	"github.com/vmware/vra-sdk-go/pkg/models"
+	"github.com/sammcgeown/vra/pkg/vra"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
@@ -53,6 +48,7 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(machinev1alpha1.AddToScheme(scheme))
+	utilruntime.Must(machinev1alpha2.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
@@ -88,7 +84,9 @@ func main() {
 			os.Exit(1)
 		}
 	}
-	ctrlConfig.RefreshToken = os.Getenv("VRA_REFRESH_TOKEN")
+	if refreshToken := os.Getenv("VRA_REFRESH_TOKEN"); refreshToken != "" {
+		ctrlConfig.RefreshToken = refreshToken
+	}
 
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), options)
 	if err != nil {
@@ -96,22 +94,90 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Get vRA Client
-	vra, err := newvRAClient(ctrlConfig.URL, ctrlConfig.RefreshToken, false)
-	if err != nil {
-		setupLog.Error(err, "unable to create vRA client")
-		os.Exit(1)
+	// Get vRA Client, the access token is renewed as required
+	vraClients := controllers.NewVRAClientCache()
+	vraConfig := vra.Config{
+		URL:      ctrlConfig.URL,
+		AuthMode: vra.AuthMode(ctrlConfig.AuthMode),
+		Username: ctrlConfig.Username,
+		Domain:   ctrlConfig.Domain,
+	}
+	credentialsRef := ctrlConfig.RefreshTokenSecretRef
+	if vraConfig.AuthMode == vra.PasswordAuth {
+		credentialsRef = ctrlConfig.PasswordSecretRef
+		if credentialsRef == nil {
+			setupLog.Error(nil, "passwordSecretRef is required when authMode is Password")
+			os.Exit(1)
+		}
+	}
+	if credentialsRef != nil {
+		// The client is built, and rebuilt, from the Secret once the manager starts
+		if err = (&controllers.CredentialsReconciler{
+			Client:    mgr.GetClient(),
+			Log:       ctrl.Log.WithName("controllers").WithName("Credentials"),
+			Recorder:  mgr.GetEventRecorderFor("vra-credentials"),
+			Clients:   vraClients,
+			Config:    vraConfig,
+			SecretRef: *credentialsRef,
+			TLS:       ctrlConfig.TLS,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "Credentials")
+			os.Exit(1)
+		}
+	} else {
+		vraConfig.RefreshToken = ctrlConfig.RefreshToken
+		if err = controllers.ApplyTLSConfig(context.Background(), mgr.GetAPIReader(), ctrlConfig.TLS, &vraConfig); err != nil {
+			setupLog.Error(err, "unable to load the TLS configuration")
+			os.Exit(1)
+		}
+		if _, err = vraClients.Update(controllers.DefaultVRAClient, vraConfig); err != nil {
+			setupLog.Error(err, "unable to create vRA client")
+			os.Exit(1)
+		}
 	}
 
-	if err = (&controllers.VirtualMachineReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-		VRA:    vra,
-		Log:    ctrl.Log.WithName("controllers").WithName("VirtualMachine"),
-	}).SetupWithManager(mgr); err != nil {
+	defaultDeletionPolicy := machinev1alpha2.DeletionPolicy(ctrlConfig.DefaultDeletionPolicy)
+	if defaultDeletionPolicy != "" && !controllers.ValidDeletionPolicy(defaultDeletionPolicy) {
+		setupLog.Error(nil, "defaultDeletionPolicy must be one of Delete, Orphan and PowerOffAndRetain", "defaultDeletionPolicy", defaultDeletionPolicy)
+		os.Exit(1)
+	}
+	virtualMachineReconciler := &controllers.VirtualMachineReconciler{
+		Client:                mgr.GetClient(),
+		Scheme:                mgr.GetScheme(),
+		Clients:               vraClients,
+		Log:                   ctrl.Log.WithName("controllers").WithName("VirtualMachine"),
+		Recorder:              mgr.GetEventRecorderFor("virtualmachine-controller"),
+		ClusterID:             ctrlConfig.ClusterID,
+		DefaultDeletionPolicy: defaultDeletionPolicy,
+	}
+	if tracking := ctrlConfig.RequestTracking; tracking != nil {
+		if tracking.PollInterval != nil {
+			virtualMachineReconciler.PollInterval = tracking.PollInterval.Duration
+		}
+		if tracking.MaxPollInterval != nil {
+			virtualMachineReconciler.MaxPollInterval = tracking.MaxPollInterval.Duration
+		}
+		virtualMachineReconciler.RequestTimeouts = controllers.RequestTimeouts(tracking.Timeouts)
+	}
+	if err = virtualMachineReconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "VirtualMachine")
 		os.Exit(1)
 	}
+	if err = (&controllers.VRAEndpointReconciler{
+		Client:   mgr.GetClient(),
+		Log:      ctrl.Log.WithName("controllers").WithName("VRAEndpoint"),
+		Recorder: mgr.GetEventRecorderFor("vraendpoint-controller"),
+		Clients:  vraClients,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "VRAEndpoint")
+		os.Exit(1)
+	}
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = (&machinev1alpha2.VirtualMachine{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "VirtualMachine")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -129,71 +195,3 @@ func main() {
 		os.Exit(1)
 	}
 }
-
-func newvRAClient(url string, refreshToken string, insecure bool) (*vraclient.MulticloudIaaS, error) {
-	// Get Token
-	token, err := getToken(url, refreshToken, insecure)
-	if err != nil {
-		return nil, err
-	}
-	// Create vRA Client
-	apiClient, err := getAPIClient(url, token, insecure)
-	if err != nil {
-		return nil, err
-	}
-	return apiClient, nil
-}
-
-// Functions below are taken from the terraform-provider-vra project
-// https://github.com/vmware/terraform-provider-vra/blob/4604d8422a43fa247edfc05058d13abb2f3458fb/vra/client.go#L210
-func getToken(url, refreshToken string, insecure bool) (string, error) {
-	parsedURL, err := neturl.Parse(url)
-	if err != nil {
-		return "", err
-	}
-	transport := httptransport.New(parsedURL.Host, parsedURL.Path, nil)
-	transport.SetDebug(false)
-	transport.Transport, err = createTransport(insecure)
-	if err != nil {
-		return "", err
-	}
-	apiclient := vraclient.New(transport, strfmt.Default)
-
-	params := login.NewRetrieveAuthTokenParams().WithBody(
-		&models.CspLoginSpecification{
-			RefreshToken: &refreshToken,
-		},
-	)
-	authTokenResponse, err := apiclient.Login.RetrieveAuthToken(params)
-	if err != nil || !strings.EqualFold(*authTokenResponse.Payload.TokenType, "bearer") {
-		return "", err
-	}
-
-	return *authTokenResponse.Payload.Token, nil
-}
-
-func createTransport(insecure bool) (http.RoundTripper, error) {
-	cfg, err := httptransport.TLSClientAuth(httptransport.TLSClientOptions{
-		InsecureSkipVerify: insecure,
-	})
-	if err != nil {
-		return nil, err
-	}
-
-	return &http.Transport{
-		TLSClientConfig: cfg,
-		Proxy:           http.ProxyFromEnvironment,
-	}, nil
-}
-
-func getAPIClient(url string, token string, insecure bool) (*vraclient.MulticloudIaaS, error) {
-	parsedURL, err := neturl.Parse(url)
-	if err != nil {
-		return nil, err
-	}
-	t := httptransport.New(parsedURL.Host, parsedURL.Path, nil)
-	t.DefaultAuthentication = httptransport.APIKeyAuth("Authorization", "header", "Bearer "+token)
-
-	apiclient := vraclient.New(t, strfmt.Default)
-	return apiclient, nil
-}
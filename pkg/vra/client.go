@@ -0,0 +1,78 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package vra builds authenticated vRealize Automation API clients
+package vra
+
+import (
+	neturl "net/url"
+
+	"github.com/go-openapi/strfmt"
+	vraclient "github.com/vmware/vra-sdk-go/pkg/client"
+)
+
+// Config holds the connection details for a vRA instance
+type Config struct {
+	URL string
+
+	// AuthMode selects the credentials used to log in, RefreshTokenAuth
+	// when empty
+	AuthMode     AuthMode
+	RefreshToken string
+	Username     string
+	Password     string
+	Domain       string
+
+	// CABundle is a PEM encoded bundle of CAs trusted in addition to the
+	// system roots
+	CABundle []byte
+	// ClientCertificate and ClientKey are a PEM encoded key pair presented
+	// to vRA when set
+	ClientCertificate []byte
+	ClientKey         []byte
+	// MinTLSVersion is one of the tls.VersionTLS constants, TLS 1.2 when zero
+	MinTLSVersion uint16
+	Insecure      bool
+}
+
+// NewClient returns a vRA client whose access token is renewed
+// automatically for as long as the credentials stay valid. The client is
+// safe for concurrent use.
+func NewClient(cfg Config) (*vraclient.MulticloudIaaS, error) {
+	parsedURL, err := neturl.Parse(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	transport, err := createTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	login, err := loginFunc(parsedURL, cfg, transport)
+	if err != nil {
+		return nil, err
+	}
+	tokens := NewTokenSource(login)
+	// Log in once up front so that bad credentials are reported straight away
+	if _, err := tokens.Token(); err != nil {
+		return nil, err
+	}
+
+	t := newRuntime(parsedURL)
+	t.Transport = &authTransport{base: transport, tokens: tokens}
+
+	return vraclient.New(t, strfmt.Default), nil
+}
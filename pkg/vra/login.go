@@ -0,0 +1,153 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vra
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"path"
+	"strings"
+	"time"
+
+	httptransport "github.com/go-openapi/runtime/client"
+	"github.com/go-openapi/strfmt"
+	vraclient "github.com/vmware/vra-sdk-go/pkg/client"
+	"github.com/vmware/vra-sdk-go/pkg/client/login"
+	"github.com/vmware/vra-sdk-go/pkg/models"
+)
+
+// AuthMode selects how the controller logs in to vRA
+type AuthMode string
+
+// AuthMode constants
+const (
+	// RefreshTokenAuth exchanges an API refresh token for access tokens, it
+	// works with vRA Cloud and on-prem vRA 8
+	RefreshTokenAuth AuthMode = "RefreshToken"
+	// PasswordAuth logs in to the identity service of an on-prem vRA 8
+	// appliance with a username and password to obtain the refresh token
+	PasswordAuth AuthMode = "Password"
+)
+
+const identityLoginTimeout = 30 * time.Second
+
+// loginFunc returns the LoginFunc for the configured AuthMode
+func loginFunc(url *neturl.URL, cfg Config, transport http.RoundTripper) (LoginFunc, error) {
+	switch cfg.AuthMode {
+	case "", RefreshTokenAuth:
+		return func() (string, error) {
+			return getToken(url, cfg.RefreshToken, transport)
+		}, nil
+	case PasswordAuth:
+		// Only called by the TokenSource with its lock held
+		var refreshToken string
+		return func() (string, error) {
+			if refreshToken != "" {
+				if token, err := getToken(url, refreshToken, transport); err == nil {
+					return token, nil
+				}
+			}
+			var err error
+			refreshToken, err = getRefreshToken(url, cfg, transport)
+			if err != nil {
+				return "", err
+			}
+			return getToken(url, refreshToken, transport)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown auth mode %q", cfg.AuthMode)
+	}
+}
+
+// Functions below are taken from the terraform-provider-vra project
+// https://github.com/vmware/terraform-provider-vra/blob/4604d8422a43fa247edfc05058d13abb2f3458fb/vra/client.go#L210
+func getToken(url *neturl.URL, refreshToken string, transport http.RoundTripper) (string, error) {
+	t := newRuntime(url)
+	t.SetDebug(false)
+	t.Transport = transport
+	apiclient := vraclient.New(t, strfmt.Default)
+
+	params := login.NewRetrieveAuthTokenParams().WithBody(
+		&models.CspLoginSpecification{
+			RefreshToken: &refreshToken,
+		},
+	)
+	authTokenResponse, err := apiclient.Login.RetrieveAuthToken(params)
+	if err != nil {
+		return "", err
+	}
+	if !strings.EqualFold(*authTokenResponse.Payload.TokenType, "bearer") {
+		return "", fmt.Errorf("unexpected token type %q", *authTokenResponse.Payload.TokenType)
+	}
+
+	return *authTokenResponse.Payload.Token, nil
+}
+
+// getRefreshToken logs in to the identity service of an on-prem vRA 8
+// appliance and returns a refresh token for the API login
+func getRefreshToken(url *neturl.URL, cfg Config, transport http.RoundTripper) (string, error) {
+	body, err := json.Marshal(struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Domain   string `json:"domain,omitempty"`
+	}{cfg.Username, cfg.Password, cfg.Domain})
+	if err != nil {
+		return "", err
+	}
+
+	loginURL := *url
+	loginURL.Path = path.Join(url.Path, "/csp/gateway/am/api/login")
+	loginURL.RawQuery = "access_token"
+	req, err := http.NewRequest(http.MethodPost, loginURL.String(), bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Transport: transport, Timeout: identityLoginTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("identity service login failed: %s", resp.Status)
+	}
+
+	var out struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", err
+	}
+	if out.RefreshToken == "" {
+		return "", fmt.Errorf("identity service login returned no refresh token")
+	}
+	return out.RefreshToken, nil
+}
+
+// newRuntime returns an API runtime for url that keeps its scheme
+func newRuntime(url *neturl.URL) *httptransport.Runtime {
+	scheme := url.Scheme
+	if scheme == "" {
+		scheme = "https"
+	}
+	return httptransport.New(url.Host, url.Path, []string{scheme})
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vra
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Password login", func() {
+	var (
+		server          *httptest.Server
+		identityLogins  int
+		apiLogins       int
+		refreshAccepted bool
+	)
+
+	BeforeEach(func() {
+		identityLogins, apiLogins = 0, 0
+		refreshAccepted = true
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.URL.Path {
+			case "/csp/gateway/am/api/login":
+				var body map[string]string
+				Expect(json.NewDecoder(r.Body).Decode(&body)).To(Succeed())
+				if body["username"] != "admin" || body["password"] != "secret" || body["domain"] != "System Domain" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				identityLogins++
+				_, _ = w.Write([]byte(`{"refresh_token":"refresh"}`))
+			case "/iaas/api/login":
+				var body map[string]string
+				Expect(json.NewDecoder(r.Body).Decode(&body)).To(Succeed())
+				if body["refreshToken"] != "refresh" || !refreshAccepted {
+					w.WriteHeader(http.StatusBadRequest)
+					_, _ = w.Write([]byte(`{"message":"invalid refresh token"}`))
+					return
+				}
+				apiLogins++
+				_, _ = w.Write([]byte(`{"token":"access","tokenType":"Bearer"}`))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	login := func(password string) LoginFunc {
+		url, err := neturl.Parse(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+		cfg := Config{AuthMode: PasswordAuth, Username: "admin", Password: password, Domain: "System Domain"}
+		fn, err := loginFunc(url, cfg, http.DefaultTransport)
+		Expect(err).NotTo(HaveOccurred())
+		return fn
+	}
+
+	It("reuses the refresh token until it is rejected", func() {
+		fn := login("secret")
+
+		token, err := fn()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token).To(Equal("access"))
+		_, err = fn()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(identityLogins).To(Equal(1))
+		Expect(apiLogins).To(Equal(2))
+
+		refreshAccepted = false
+		_, err = fn()
+		Expect(err).To(HaveOccurred())
+		Expect(identityLogins).To(Equal(2))
+	})
+
+	It("reports a rejected password", func() {
+		_, err := login("wrong")()
+		Expect(err).To(MatchError(ContainSubstring("identity service login failed")))
+	})
+
+	It("builds a client with the password flow", func() {
+		_, err := NewClient(Config{URL: server.URL, AuthMode: PasswordAuth, Username: "admin", Password: "secret", Domain: "System Domain"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(identityLogins).To(Equal(1))
+	})
+})
@@ -0,0 +1,131 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vra
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// refreshBeforeExpiry is how long before expiry a token is renewed
+	refreshBeforeExpiry = 5 * time.Minute
+	// defaultTokenLifetime is assumed when the token expiry cannot be read
+	defaultTokenLifetime = 25 * time.Minute
+	// loginRetryBackoff is how long a failed renewal waits before the next
+	// one while the current token is still valid
+	loginRetryBackoff = 30 * time.Second
+)
+
+// LoginFunc exchanges the configured credentials for a new access token
+type LoginFunc func() (string, error)
+
+// TokenSource hands out vRA access tokens and renews them shortly before
+// they expire, or as soon as one is rejected. It is safe for concurrent use.
+type TokenSource struct {
+	login LoginFunc
+	now   func() time.Time
+
+	mu        sync.Mutex
+	token     string
+	expiry    time.Time
+	refreshAt time.Time
+	// retryAt is when renewal may be tried again after a failed login
+	retryAt time.Time
+}
+
+// NewTokenSource returns a TokenSource that obtains tokens from login
+func NewTokenSource(login LoginFunc) *TokenSource {
+	return &TokenSource{
+		login: login,
+		now:   time.Now,
+	}
+}
+
+// Token returns a valid access token, logging in again if the current token
+// is missing or about to expire.
+func (s *TokenSource) Token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if s.token != "" && now.Before(s.refreshAt) {
+		return s.token, nil
+	}
+	if s.token != "" && now.Before(s.expiry) && now.Before(s.retryAt) {
+		// The last renewal failed, wait before logging in again
+		return s.token, nil
+	}
+
+	token, err := s.login()
+	if err != nil {
+		// Keep serving the old token while it is still valid, renewal is
+		// tried again after loginRetryBackoff.
+		if s.token != "" && now.Before(s.expiry) {
+			s.retryAt = now.Add(loginRetryBackoff)
+			return s.token, nil
+		}
+		return "", err
+	}
+
+	s.token = token
+	s.expiry = tokenExpiry(token, now)
+	lifetime := s.expiry.Sub(now)
+	margin := refreshBeforeExpiry
+	if lifetime < 2*margin {
+		margin = lifetime / 2
+	}
+	s.refreshAt = s.expiry.Add(-margin)
+	return s.token, nil
+}
+
+// Invalidate discards token if it is still the current token, so that the
+// next call to Token logs in again. It is used when vRA rejects a token
+// before its expected expiry.
+func (s *TokenSource) Invalidate(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token == token {
+		s.token = ""
+	}
+}
+
+// tokenExpiry reads the exp claim of a JWT access token, falling back to
+// defaultTokenLifetime if the token cannot be decoded.
+func tokenExpiry(token string, issued time.Time) time.Time {
+	fallback := issued.Add(defaultTokenLifetime)
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return fallback
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return fallback
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return fallback
+	}
+	return time.Unix(claims.Exp, 0)
+}
@@ -0,0 +1,174 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vra
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// fakeJWT returns an unsigned JWT with the given expiry
+func fakeJWT(exp time.Time, id int) string {
+	claims := fmt.Sprintf(`{"exp":%d,"jti":"%d"}`, exp.Unix(), id)
+	return "e30." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".sig"
+}
+
+var _ = Describe("TokenSource", func() {
+	var (
+		now    time.Time
+		logins int
+		fail   bool
+		source *TokenSource
+	)
+
+	BeforeEach(func() {
+		now = time.Unix(1600000000, 0)
+		logins = 0
+		fail = false
+		source = NewTokenSource(func() (string, error) {
+			if fail {
+				return "", errors.New("login failed")
+			}
+			logins++
+			return fakeJWT(now.Add(30*time.Minute), logins), nil
+		})
+		source.now = func() time.Time { return now }
+	})
+
+	It("reuses a token until it is close to expiry", func() {
+		first, err := source.Token()
+		Expect(err).NotTo(HaveOccurred())
+
+		now = now.Add(20 * time.Minute)
+		second, err := source.Token()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(second).To(Equal(first))
+		Expect(logins).To(Equal(1))
+
+		now = now.Add(6 * time.Minute)
+		third, err := source.Token()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(third).NotTo(Equal(first))
+		Expect(logins).To(Equal(2))
+	})
+
+	It("keeps serving a valid token when renewal fails", func() {
+		first, err := source.Token()
+		Expect(err).NotTo(HaveOccurred())
+
+		fail = true
+		now = now.Add(27 * time.Minute)
+		token, err := source.Token()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token).To(Equal(first))
+
+		now = now.Add(5 * time.Minute)
+		_, err = source.Token()
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("waits before retrying a failed renewal", func() {
+		first, err := source.Token()
+		Expect(err).NotTo(HaveOccurred())
+
+		attempts := 0
+		source.login = func() (string, error) {
+			attempts++
+			return "", errors.New("login failed")
+		}
+		now = now.Add(26 * time.Minute)
+		for i := 0; i < 3; i++ {
+			token, err := source.Token()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(token).To(Equal(first))
+		}
+		Expect(attempts).To(Equal(1))
+
+		now = now.Add(loginRetryBackoff)
+		_, err = source.Token()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(attempts).To(Equal(2))
+	})
+
+	It("only discards the token that was rejected", func() {
+		first, _ := source.Token()
+		source.Invalidate("some-older-token")
+		token, _ := source.Token()
+		Expect(token).To(Equal(first))
+
+		source.Invalidate(first)
+		token, _ = source.Token()
+		Expect(token).NotTo(Equal(first))
+		Expect(logins).To(Equal(2))
+	})
+
+	It("falls back to the default lifetime for opaque tokens", func() {
+		Expect(tokenExpiry("opaque", now)).To(Equal(now.Add(defaultTokenLifetime)))
+	})
+
+	It("logs in once for concurrent callers", func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				_, err := source.Token()
+				Expect(err).NotTo(HaveOccurred())
+			}()
+		}
+		wg.Wait()
+		Expect(logins).To(Equal(1))
+	})
+})
+
+var _ = Describe("authTransport", func() {
+	It("retries once with a new token when vRA answers 401", func() {
+		logins := 0
+		source := NewTokenSource(func() (string, error) {
+			logins++
+			return fmt.Sprintf("token-%d", logins), nil
+		})
+
+		var seen []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			seen = append(seen, r.Header.Get("Authorization"))
+			if r.Header.Get("Authorization") == "Bearer token-1" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		client := &http.Client{Transport: &authTransport{base: http.DefaultTransport, tokens: source}}
+		resp, err := client.Get(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(seen).To(Equal([]string{"Bearer token-1", "Bearer token-2"}))
+	})
+})
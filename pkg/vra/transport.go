@@ -0,0 +1,117 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vra
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	httptransport "github.com/go-openapi/runtime/client"
+)
+
+// createTransport returns the transport shared by the login and API calls,
+// so that both use the same TLS settings
+func createTransport(cfg Config) (http.RoundTripper, error) {
+	opts := httptransport.TLSClientOptions{
+		InsecureSkipVerify: cfg.Insecure,
+	}
+	if len(cfg.CABundle) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(cfg.CABundle) {
+			return nil, errors.New("no certificates found in CA bundle")
+		}
+		opts.LoadedCAPool = pool
+	}
+	tlsConfig, err := httptransport.TLSClientAuth(opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.ClientCertificate) > 0 {
+		cert, err := tls.X509KeyPair(cfg.ClientCertificate, cfg.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("tls client cert: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	tlsConfig.MinVersion = tls.VersionTLS12
+	if cfg.MinTLSVersion != 0 {
+		tlsConfig.MinVersion = cfg.MinTLSVersion
+	}
+
+	return &http.Transport{
+		TLSClientConfig: tlsConfig,
+		Proxy:           http.ProxyFromEnvironment,
+	}, nil
+}
+
+// authTransport adds a bearer token from a TokenSource to every request. If
+// vRA answers 401 the token is discarded and the request is retried once
+// with a freshly issued one.
+type authTransport struct {
+	base   http.RoundTripper
+	tokens *TokenSource
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.tokens.Token()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.base.RoundTrip(withBearer(req, token))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	// The body has already been consumed and cannot be replayed
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil
+	}
+
+	t.tokens.Invalidate(token)
+	token, err = t.tokens.Token()
+	if err != nil {
+		return resp, nil
+	}
+
+	retry := withBearer(req, token)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+		retry.Body = body
+	}
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+
+	return t.base.RoundTrip(retry)
+}
+
+// withBearer returns a copy of req carrying token in its Authorization header
+func withBearer(req *http.Request, token string) *http.Request {
+	out := req.Clone(req.Context())
+	out.Header.Set("Authorization", "Bearer "+token)
+	return out
+}
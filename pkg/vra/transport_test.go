@@ -0,0 +1,71 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vra
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TLS settings", func() {
+	var (
+		server   *httptest.Server
+		caBundle []byte
+	)
+
+	BeforeEach(func() {
+		server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"token":"access","tokenType":"Bearer"}`))
+		}))
+		server.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+		server.StartTLS()
+		caBundle = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("trusts the CA bundle for the login", func() {
+		_, err := NewClient(Config{URL: server.URL, RefreshToken: "refresh"})
+		Expect(err).To(HaveOccurred())
+
+		_, err = NewClient(Config{URL: server.URL, RefreshToken: "refresh", CABundle: caBundle})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("skips verification when insecure", func() {
+		_, err := NewClient(Config{URL: server.URL, RefreshToken: "refresh", Insecure: true})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("enforces the minimum TLS version", func() {
+		_, err := NewClient(Config{URL: server.URL, RefreshToken: "refresh", CABundle: caBundle, MinTLSVersion: tls.VersionTLS13})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("rejects a bundle without certificates", func() {
+		_, err := NewClient(Config{URL: server.URL, RefreshToken: "refresh", CABundle: []byte("not a certificate")})
+		Expect(err).To(MatchError(ContainSubstring("no certificates")))
+	})
+})
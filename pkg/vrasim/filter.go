@@ -0,0 +1,112 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vrasim
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/vmware/vra-sdk-go/pkg/models"
+)
+
+// tagClause matches one side of a tag filter, e.g. tags.item.key eq 'k8s_name'
+var tagClause = regexp.MustCompile(`^tags\.item\.(key|value) eq '((?:[^']|'')*)'$`)
+
+// parseTagFilter reads an OData $filter made of key and value pairs joined
+// by "and", the only form of filter the controllers send. An empty filter
+// matches every machine.
+func parseTagFilter(filter string) (map[string]string, error) {
+	tags := map[string]string{}
+	if strings.TrimSpace(filter) == "" {
+		return tags, nil
+	}
+
+	var key *string
+	for _, clause := range splitAnd(filter) {
+		match := tagClause.FindStringSubmatch(clause)
+		if match == nil {
+			return nil, fmt.Errorf("unsupported filter clause %q", clause)
+		}
+		value := strings.ReplaceAll(match[2], "''", "'")
+		switch {
+		case match[1] == "key" && key == nil:
+			key = &value
+		case match[1] == "value" && key != nil:
+			tags[*key] = value
+			key = nil
+		default:
+			return nil, fmt.Errorf("filter clause %q is not part of a key and value pair", clause)
+		}
+	}
+	if key != nil {
+		return nil, fmt.Errorf("filter has no value for tag key %q", *key)
+	}
+	return tags, nil
+}
+
+// projectClause matches a project filter, e.g. projectId eq 'web'
+var projectClause = regexp.MustCompile(`^projectId eq '((?:[^']|'')*)'$`)
+
+// parseProjectFilter reads an OData $filter on the project id, the only
+// filter the controllers send for networks. An empty filter matches every
+// network.
+func parseProjectFilter(filter string) (string, bool, error) {
+	if strings.TrimSpace(filter) == "" {
+		return "", false, nil
+	}
+	match := projectClause.FindStringSubmatch(strings.TrimSpace(filter))
+	if match == nil {
+		return "", false, fmt.Errorf("unsupported filter %q", filter)
+	}
+	return strings.ReplaceAll(match[1], "''", "'"), true, nil
+}
+
+// splitAnd splits filter on the "and" operators outside string literals
+func splitAnd(filter string) []string {
+	var clauses []string
+	inString := false
+	start := 0
+	for i := 0; i < len(filter); i++ {
+		switch {
+		case filter[i] == '\'':
+			inString = !inString
+		case !inString && strings.HasPrefix(filter[i:], " and "):
+			clauses = append(clauses, strings.TrimSpace(filter[start:i]))
+			start = i + len(" and ")
+			i = start - 1
+		}
+	}
+	return append(clauses, strings.TrimSpace(filter[start:]))
+}
+
+// matchesTags reports whether machine carries all of tags
+func matchesTags(machine *models.Machine, tags map[string]string) bool {
+	for key, value := range tags {
+		found := false
+		for _, tag := range machine.Tags {
+			if tag.Key != nil && tag.Value != nil && *tag.Key == key && *tag.Value == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,943 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package vrasim simulates the parts of the vRealize Automation IaaS API used
+// by the controllers, so they can be tested without a vRA instance.
+package vrasim
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vmware/vra-sdk-go/pkg/models"
+)
+
+const (
+	apiPrefix            = "/iaas/api/"
+	machinesPath         = apiPrefix + "machines"
+	blockDevicesPath     = apiPrefix + "block-devices"
+	networksPath         = apiPrefix + "networks"
+	requestTrackerPath   = apiPrefix + "request-tracker"
+	loginPath            = apiPrefix + "login"
+	defaultOrganization  = "vrasim-org"
+	defaultRegion        = "vrasim-region"
+	defaultZone          = "vrasim-zone"
+	defaultCloudAccount  = "vrasim-cloud-account"
+	defaultMachineOwner  = "vrasim@example.com"
+	defaultTrackerPrefix = "/iaas/api/request-tracker/"
+	defaultNetwork       = "vrasim-network"
+	defaultPageSize      = 20
+)
+
+// Options configure a Server
+type Options struct {
+	// RefreshToken accepted by the login endpoint, any refresh token is
+	// accepted when empty
+	RefreshToken string
+
+	// Latency is added to every response
+	Latency time.Duration
+
+	// RequestDuration is how long asynchronous requests stay in progress,
+	// they finish on the first poll when zero
+	RequestDuration time.Duration
+
+	// PageSize is the largest number of elements listed per page, whatever
+	// the $top set by the client, it defaults to defaultPageSize
+	PageSize int
+}
+
+// Server is a running vRA IaaS API simulator
+type Server struct {
+	// URL of the simulator, to be used as the vRA URL
+	URL string
+
+	server *httptest.Server
+	opts   Options
+	now    func() time.Time
+
+	mu           sync.Mutex
+	nextID       int
+	tokens       map[string]bool
+	machines     map[string]*models.Machine
+	blockDevices map[string]*models.BlockDevice
+	// attached maps the ID of a block device to the machine it is attached to
+	attached     map[string]string
+	networks     map[string]*models.Network
+	nics         map[string]*models.NetworkInterface
+	requests     map[string]*trackedRequest
+	faults       []fault
+	failRequests []string
+	held         bool
+}
+
+// trackedRequest is an asynchronous vRA request
+type trackedRequest struct {
+	tracker   *models.RequestTracker
+	submitted time.Time
+	// failure is the message the request fails with, it succeeds when empty
+	failure string
+	// complete applies the request once it finishes successfully
+	complete func(tracker *models.RequestTracker)
+}
+
+// fault is an error returned by the next call matching method and path
+type fault struct {
+	method  string
+	path    string
+	status  int
+	message string
+}
+
+// NewServer starts a simulator, it must be closed with Close
+func NewServer(opts Options) *Server {
+	s := &Server{
+		opts:         opts,
+		now:          time.Now,
+		tokens:       map[string]bool{},
+		machines:     map[string]*models.Machine{},
+		blockDevices: map[string]*models.BlockDevice{},
+		attached:     map[string]string{},
+		networks:     map[string]*models.Network{},
+		nics:         map[string]*models.NetworkInterface{},
+		requests:     map[string]*trackedRequest{},
+	}
+	s.networks[defaultNetwork] = &models.Network{
+		ID:    stringPtr(defaultNetwork),
+		Name:  defaultNetwork,
+		Cidr:  stringPtr("10.0.0.0/16"),
+		Links: map[string]models.Href{"self": {Href: networksPath + "/" + defaultNetwork}},
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.server.URL
+	return s
+}
+
+// Close shuts the simulator down
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// FailNext makes the next call with method to a path starting with path
+// fail with status and message
+func (s *Server) FailNext(method, path string, status int, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, fault{method: method, path: path, status: status, message: message})
+}
+
+// FailNextRequest makes the next asynchronous request end in the FAILED
+// state with message
+func (s *Server) FailNextRequest(message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failRequests = append(s.failRequests, message)
+}
+
+// Hold keeps asynchronous requests in progress until Release is called
+func (s *Server) Hold() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.held = true
+}
+
+// Release lets held requests finish, the ones already due finish straight
+// away
+func (s *Server) Release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.held = false
+	s.advance()
+}
+
+// ExpireTokens revokes every access token, clients have to log in again
+func (s *Server) ExpireTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens = map[string]bool{}
+}
+
+// AddMachine stores machine as if it had been provisioned, an ID is assigned
+// when it has none. The ID is returned.
+func (s *Server) AddMachine(machine *models.Machine) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *machine
+	if stored.ID == nil {
+		id := s.newID("machine")
+		stored.ID = &id
+	}
+	if stored.PowerState == nil {
+		stored.PowerState = stringPtr(models.MachinePowerStateON)
+	}
+	stored.Links = map[string]models.Href{"self": {Href: machinesPath + "/" + *stored.ID}}
+	s.machines[*stored.ID] = &stored
+	return *stored.ID
+}
+
+// Machine returns a copy of the machine with id
+func (s *Server) Machine(id string) (*models.Machine, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	machine, ok := s.machines[id]
+	if !ok {
+		return nil, false
+	}
+	copied := *machine
+	return &copied, true
+}
+
+// Machines returns copies of all machines
+func (s *Server) Machines() []*models.Machine {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	machines := make([]*models.Machine, 0, len(s.machines))
+	for _, machine := range s.machines {
+		copied := *machine
+		machines = append(machines, &copied)
+	}
+	return machines
+}
+
+// SetMachineTags replaces the tags of the machine with id, as an edit made
+// outside of the API would
+func (s *Server) SetMachineTags(id string, tags []*models.Tag) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if machine, ok := s.machines[id]; ok {
+		machine.Tags = tags
+	}
+}
+
+// AddNetwork stores network so that machines can be connected to it, an ID
+// is assigned when it has none. The ID is returned.
+func (s *Server) AddNetwork(network *models.Network) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *network
+	if stored.ID == nil {
+		id := s.newID("network")
+		stored.ID = &id
+	}
+	stored.Links = map[string]models.Href{"self": {Href: networksPath + "/" + *stored.ID}}
+	s.networks[*stored.ID] = &stored
+	return *stored.ID
+}
+
+// NetworkInterface returns a copy of the network interface with id
+func (s *Server) NetworkInterface(id string) (*models.NetworkInterface, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	nic, ok := s.nics[id]
+	if !ok {
+		return nil, false
+	}
+	copied := *nic
+	return &copied, true
+}
+
+// BlockDevices returns copies of all block devices
+func (s *Server) BlockDevices() []*models.BlockDevice {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	devices := make([]*models.BlockDevice, 0, len(s.blockDevices))
+	for _, device := range s.blockDevices {
+		copied := *device
+		devices = append(devices, &copied)
+	}
+	return devices
+}
+
+// Pending returns the number of requests still in progress
+func (s *Server) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.advance()
+	pending := 0
+	for _, request := range s.requests {
+		if *request.tracker.Status == models.RequestTrackerStatusINPROGRESS {
+			pending++
+		}
+	}
+	return pending
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.opts.Latency > 0 {
+		time.Sleep(s.opts.Latency)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if f, ok := s.takeFault(r); ok {
+		writeError(w, f.status, f.message)
+		return
+	}
+
+	if r.URL.Path == loginPath {
+		s.login(w, r)
+		return
+	}
+	if !s.authorized(r) {
+		writeError(w, http.StatusUnauthorized, "invalid or expired access token")
+		return
+	}
+	s.advance()
+
+	switch {
+	case r.URL.Path == machinesPath && r.Method == http.MethodGet:
+		s.getMachines(w, r)
+	case r.URL.Path == machinesPath && r.Method == http.MethodPost:
+		s.createMachine(w, r)
+	case strings.HasPrefix(r.URL.Path, machinesPath+"/"):
+		parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, machinesPath+"/"), "/", 3)
+		switch {
+		case len(parts) == 1:
+			s.machine(w, r, parts[0])
+		case len(parts) == 3 && parts[1] == "operations":
+			s.machineOperation(w, r, parts[0], parts[2])
+		case parts[1] == "disks":
+			s.machineDisks(w, r, parts[0], parts[2:])
+		case len(parts) == 3 && parts[1] == "network-interfaces" && r.Method == http.MethodGet:
+			s.getNetworkInterface(w, parts[0], parts[2])
+		default:
+			writeError(w, http.StatusNotFound, fmt.Sprintf("%s %s is not simulated", r.Method, r.URL.Path))
+		}
+	case r.URL.Path == networksPath && r.Method == http.MethodGet:
+		s.getNetworks(w, r)
+	case r.URL.Path == blockDevicesPath && r.Method == http.MethodPost:
+		s.createBlockDevice(w, r)
+	case strings.HasPrefix(r.URL.Path, blockDevicesPath+"/"):
+		s.blockDevice(w, r, strings.TrimPrefix(r.URL.Path, blockDevicesPath+"/"))
+	case strings.HasPrefix(r.URL.Path, requestTrackerPath+"/") && r.Method == http.MethodGet:
+		s.getRequestTracker(w, strings.TrimPrefix(r.URL.Path, requestTrackerPath+"/"))
+	default:
+		writeError(w, http.StatusNotFound, fmt.Sprintf("%s %s is not simulated", r.Method, r.URL.Path))
+	}
+}
+
+// takeFault removes and returns the first fault matching r
+func (s *Server) takeFault(r *http.Request) (fault, bool) {
+	for i, f := range s.faults {
+		if f.method == r.Method && strings.HasPrefix(r.URL.Path, f.path) {
+			s.faults = append(s.faults[:i], s.faults[i+1:]...)
+			return f, true
+		}
+	}
+	return fault{}, false
+}
+
+func (s *Server) login(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "login requires POST")
+		return
+	}
+	var body models.CspLoginSpecification
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid login request: "+err.Error())
+		return
+	}
+	if body.RefreshToken == nil || *body.RefreshToken == "" ||
+		(s.opts.RefreshToken != "" && *body.RefreshToken != s.opts.RefreshToken) {
+		writeError(w, http.StatusBadRequest, "invalid refresh token")
+		return
+	}
+
+	token := s.newID("token")
+	s.tokens[token] = true
+	writeJSON(w, http.StatusOK, models.AuthResponse{Token: &token, TokenType: stringPtr("Bearer")})
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	return s.tokens[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")]
+}
+
+func (s *Server) getMachines(w http.ResponseWriter, r *http.Request) {
+	tags, err := parseTagFilter(r.URL.Query().Get("$filter"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var ids []string
+	for id, machine := range s.machines {
+		if matchesTags(machine, tags) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	start, end, err := s.page(r, len(ids))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result := models.MachineResult{Content: []*models.Machine{}, TotalElements: int64(len(ids))}
+	for _, id := range ids[start:end] {
+		copied := *s.machines[id]
+		result.Content = append(result.Content, &copied)
+	}
+	result.NumberOfElements = int64(len(result.Content))
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) createMachine(w http.ResponseWriter, r *http.Request) {
+	var spec models.MachineSpecification
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid machine specification: "+err.Error())
+		return
+	}
+	if spec.Name == nil || *spec.Name == "" || spec.ProjectID == nil || *spec.ProjectID == "" ||
+		spec.Flavor == nil || *spec.Flavor == "" {
+		writeError(w, http.StatusBadRequest, "name, projectId and flavor are required")
+		return
+	}
+	if (spec.Image == nil || *spec.Image == "") == (spec.ImageRef == nil || *spec.ImageRef == "") {
+		writeError(w, http.StatusBadRequest, "one of image and imageRef is required")
+		return
+	}
+	if spec.MachineCount > 1 {
+		writeError(w, http.StatusBadRequest, "the simulator creates a single machine per request")
+		return
+	}
+	for _, disk := range spec.Disks {
+		if disk.BlockDeviceID == nil {
+			writeError(w, http.StatusBadRequest, "disks require a blockDeviceId")
+			return
+		}
+		if _, ok := s.blockDevices[*disk.BlockDeviceID]; !ok {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("block device %s not found", *disk.BlockDeviceID))
+			return
+		}
+	}
+	for _, nic := range spec.Nics {
+		if nic.NetworkID == nil {
+			writeError(w, http.StatusBadRequest, "nics require a networkId")
+			return
+		}
+		if _, ok := s.networks[*nic.NetworkID]; !ok {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("network %s not found", *nic.NetworkID))
+			return
+		}
+	}
+
+	id := s.newID("machine")
+	now := s.now().UTC().Format(time.RFC3339)
+	// Machines without network interfaces get one on the default network
+	nicSpecs := spec.Nics
+	if len(nicSpecs) == 0 {
+		nicSpecs = []*models.NetworkInterfaceSpecification{{NetworkID: stringPtr(defaultNetwork)}}
+	}
+	var nics []*models.NetworkInterface
+	var nicLinks []string
+	for i, nicSpec := range nicSpecs {
+		nicID := s.newID("nic")
+		addresses := nicSpec.Addresses
+		if len(addresses) == 0 {
+			addresses = []string{fmt.Sprintf("10.0.%d.%d", i, s.nextID%250+1)}
+		}
+		nics = append(nics, &models.NetworkInterface{
+			ID:               &nicID,
+			Name:             nicSpec.Name,
+			Description:      nicSpec.Description,
+			DeviceIndex:      nicSpec.DeviceIndex,
+			Addresses:        addresses,
+			SecurityGroupIds: nicSpec.SecurityGroupIds,
+			CustomProperties: map[string]string{"networkId": *nicSpec.NetworkID},
+			Links:            map[string]models.Href{"self": {Href: machinesPath + "/" + id + "/network-interfaces/" + nicID}},
+		})
+		nicLinks = append(nicLinks, machinesPath+"/"+id+"/network-interfaces/"+nicID)
+	}
+	// vRA reports the flavor a machine was sized with as a custom property
+	customProperties := map[string]string{"flavor": *spec.Flavor}
+	for key, value := range spec.CustomProperties {
+		customProperties[key] = value
+	}
+	machine := &models.Machine{
+		ID:               &id,
+		Name:             *spec.Name,
+		Description:      spec.Description,
+		ProjectID:        *spec.ProjectID,
+		Tags:             spec.Tags,
+		CustomProperties: customProperties,
+		BootConfig:       spec.BootConfig,
+		PowerState:       stringPtr(models.MachinePowerStateON),
+		Address:          nics[0].Addresses[0],
+		Hostname:         *spec.Name,
+		ExternalID:       "vm-" + id,
+		ExternalRegionID: stringPtr(defaultRegion),
+		ExternalZoneID:   stringPtr(defaultZone),
+		CloudAccountIds:  []string{defaultCloudAccount},
+		OrgID:            defaultOrganization,
+		Owner:            defaultMachineOwner,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+		Links: map[string]models.Href{
+			"self":               {Href: machinesPath + "/" + id},
+			"network-interfaces": {Hrefs: nicLinks},
+		},
+	}
+
+	tracker := s.submit("Provisioning", func(tracker *models.RequestTracker) {
+		s.machines[id] = machine
+		for _, nic := range nics {
+			s.nics[*nic.ID] = nic
+		}
+		for _, disk := range spec.Disks {
+			s.attach(*disk.BlockDeviceID, id)
+		}
+		tracker.Resources = []string{machinesPath + "/" + id}
+	})
+	writeJSON(w, http.StatusAccepted, tracker)
+}
+
+func (s *Server) machine(w http.ResponseWriter, r *http.Request, id string) {
+	machine, ok := s.machines[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("machine %s not found", id))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, machine)
+	case http.MethodPatch:
+		var update models.UpdateMachineSpecification
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid machine update: "+err.Error())
+			return
+		}
+		if update.Tags != nil {
+			machine.Tags = update.Tags
+		}
+		if update.Description != "" {
+			machine.Description = update.Description
+		}
+		for key, value := range update.CustomProperties {
+			machine.CustomProperties[key] = value
+		}
+		machine.UpdatedAt = s.now().UTC().Format(time.RFC3339)
+		writeJSON(w, http.StatusOK, machine)
+	case http.MethodDelete:
+		tracker := s.submit("Remove Machine", func(tracker *models.RequestTracker) {
+			delete(s.machines, id)
+			for _, href := range machine.Links["network-interfaces"].Hrefs {
+				delete(s.nics, path.Base(href))
+			}
+			// Non-persistent disks go with the machine
+			for diskID, machineID := range s.attached {
+				if machineID == id {
+					s.detach(diskID)
+					if !s.blockDevices[diskID].Persistent {
+						delete(s.blockDevices, diskID)
+					}
+				}
+			}
+			tracker.Resources = []string{machinesPath + "/" + id}
+		})
+		writeJSON(w, http.StatusAccepted, tracker)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Sprintf("%s is not supported on machines", r.Method))
+	}
+}
+
+// powerOperations are the power day-2 operations and the power state they
+// leave the machine in
+var powerOperations = map[string]struct {
+	name       string
+	powerState string
+}{
+	"power-on":  {"Power On", models.MachinePowerStateON},
+	"power-off": {"Power Off", models.MachinePowerStateOFF},
+	"shutdown":  {"Shutdown", models.MachinePowerStateOFF},
+	"suspend":   {"Suspend", models.MachinePowerStateSUSPEND},
+}
+
+func (s *Server) machineOperation(w http.ResponseWriter, r *http.Request, id, operation string) {
+	machine, ok := s.machines[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("machine %s not found", id))
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "operations require POST")
+		return
+	}
+
+	if power, ok := powerOperations[operation]; ok {
+		tracker := s.submit(power.name, func(tracker *models.RequestTracker) {
+			machine.PowerState = stringPtr(power.powerState)
+			machine.UpdatedAt = s.now().UTC().Format(time.RFC3339)
+			tracker.Resources = []string{machinesPath + "/" + id}
+		})
+		writeJSON(w, http.StatusAccepted, tracker)
+		return
+	}
+	if operation == "resize" {
+		flavor := r.URL.Query().Get("name")
+		if flavor == "" {
+			writeError(w, http.StatusBadRequest, "resize requires a flavor name")
+			return
+		}
+		tracker := s.submit("Resize", func(tracker *models.RequestTracker) {
+			if machine.CustomProperties == nil {
+				machine.CustomProperties = map[string]string{}
+			}
+			machine.CustomProperties["flavor"] = flavor
+			machine.UpdatedAt = s.now().UTC().Format(time.RFC3339)
+			tracker.Resources = []string{machinesPath + "/" + id}
+		})
+		writeJSON(w, http.StatusAccepted, tracker)
+		return
+	}
+	writeError(w, http.StatusNotFound, fmt.Sprintf("operation %s is not simulated", operation))
+}
+
+// machineDisks serves the disks of a machine, rest is the path after disks
+func (s *Server) machineDisks(w http.ResponseWriter, r *http.Request, id string, rest []string) {
+	if _, ok := s.machines[id]; !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("machine %s not found", id))
+		return
+	}
+
+	switch {
+	case len(rest) == 0 && r.Method == http.MethodGet:
+		result := models.BlockDeviceResult{Content: []*models.BlockDevice{}}
+		for diskID, machineID := range s.attached {
+			if machineID == id {
+				copied := *s.blockDevices[diskID]
+				result.Content = append(result.Content, &copied)
+			}
+		}
+		result.NumberOfElements = int64(len(result.Content))
+		result.TotalElements = result.NumberOfElements
+		writeJSON(w, http.StatusOK, result)
+	case len(rest) == 0 && r.Method == http.MethodPost:
+		var spec models.DiskAttachmentSpecification
+		if err := json.NewDecoder(r.Body).Decode(&spec); err != nil || spec.BlockDeviceID == nil {
+			writeError(w, http.StatusBadRequest, "invalid disk attachment specification")
+			return
+		}
+		diskID := *spec.BlockDeviceID
+		if _, ok := s.blockDevices[diskID]; !ok {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("block device %s not found", diskID))
+			return
+		}
+		if _, ok := s.attached[diskID]; ok {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("block device %s is already attached", diskID))
+			return
+		}
+		tracker := s.submit("Attach Disk", func(tracker *models.RequestTracker) {
+			s.attach(diskID, id)
+			tracker.Resources = []string{machinesPath + "/" + id}
+		})
+		writeJSON(w, http.StatusOK, tracker)
+	case len(rest) == 1 && r.Method == http.MethodDelete:
+		diskID := rest[0]
+		if s.attached[diskID] != id {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("block device %s is not attached to machine %s", diskID, id))
+			return
+		}
+		tracker := s.submit("Detach Disk", func(tracker *models.RequestTracker) {
+			s.detach(diskID)
+			tracker.Resources = []string{machinesPath + "/" + id}
+		})
+		writeJSON(w, http.StatusAccepted, tracker)
+	default:
+		writeError(w, http.StatusNotFound, fmt.Sprintf("%s %s is not simulated", r.Method, r.URL.Path))
+	}
+}
+
+func (s *Server) createBlockDevice(w http.ResponseWriter, r *http.Request) {
+	var spec models.BlockDeviceSpecification
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid block device specification: "+err.Error())
+		return
+	}
+	if spec.Name == nil || *spec.Name == "" || spec.ProjectID == nil || *spec.ProjectID == "" ||
+		spec.CapacityInGB == nil || *spec.CapacityInGB <= 0 {
+		writeError(w, http.StatusBadRequest, "name, projectId and capacityInGB are required")
+		return
+	}
+
+	id := s.newID("disk")
+	now := s.now().UTC().Format(time.RFC3339)
+	device := &models.BlockDevice{
+		ID:               &id,
+		Name:             *spec.Name,
+		Description:      spec.Description,
+		CapacityInGB:     spec.CapacityInGB,
+		Persistent:       spec.Persistent,
+		ProjectID:        *spec.ProjectID,
+		Tags:             spec.Tags,
+		CustomProperties: spec.CustomProperties,
+		Status:           stringPtr(models.BlockDeviceStatusAVAILABLE),
+		Type:             "HDD",
+		ExternalRegionID: stringPtr(defaultRegion),
+		ExternalZoneID:   stringPtr(defaultZone),
+		CloudAccountIds:  []string{defaultCloudAccount},
+		OrgID:            defaultOrganization,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+		Links:            map[string]models.Href{"self": {Href: blockDevicesPath + "/" + id}},
+	}
+	tracker := s.submit("Create Disk", func(tracker *models.RequestTracker) {
+		s.blockDevices[id] = device
+		tracker.Resources = []string{blockDevicesPath + "/" + id}
+	})
+	writeJSON(w, http.StatusAccepted, tracker)
+}
+
+func (s *Server) blockDevice(w http.ResponseWriter, r *http.Request, id string) {
+	device, ok := s.blockDevices[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("block device %s not found", id))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, device)
+	case http.MethodPost:
+		capacity, err := strconv.ParseInt(r.URL.Query().Get("capacityInGB"), 10, 32)
+		if err != nil || capacity <= 0 {
+			writeError(w, http.StatusBadRequest, "resize requires a positive capacityInGB")
+			return
+		}
+		if int32(capacity) == *device.CapacityInGB {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if int32(capacity) < *device.CapacityInGB {
+			writeError(w, http.StatusBadRequest, "disks cannot shrink")
+			return
+		}
+		tracker := s.submit("Resize Disk", func(tracker *models.RequestTracker) {
+			device.CapacityInGB = int32Ptr(int32(capacity))
+			device.UpdatedAt = s.now().UTC().Format(time.RFC3339)
+			tracker.Resources = []string{blockDevicesPath + "/" + id}
+		})
+		writeJSON(w, http.StatusAccepted, tracker)
+	case http.MethodDelete:
+		if _, ok := s.attached[id]; ok {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("block device %s is attached", id))
+			return
+		}
+		tracker := s.submit("Delete Disk", func(tracker *models.RequestTracker) {
+			delete(s.blockDevices, id)
+			tracker.Resources = []string{blockDevicesPath + "/" + id}
+		})
+		writeJSON(w, http.StatusAccepted, tracker)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Sprintf("%s is not supported on block devices", r.Method))
+	}
+}
+
+// attach records the block device with diskID as attached to a machine
+func (s *Server) attach(diskID, machineID string) {
+	s.attached[diskID] = machineID
+	s.blockDevices[diskID].Status = stringPtr(models.BlockDeviceStatusATTACHED)
+}
+
+// detach records the block device with diskID as detached
+func (s *Server) detach(diskID string) {
+	delete(s.attached, diskID)
+	s.blockDevices[diskID].Status = stringPtr(models.BlockDeviceStatusAVAILABLE)
+}
+
+func (s *Server) getNetworks(w http.ResponseWriter, r *http.Request) {
+	projectID, filtered, err := parseProjectFilter(r.URL.Query().Get("$filter"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ids := make([]string, 0, len(s.networks))
+	for id, network := range s.networks {
+		if !filtered || network.ProjectID == projectID {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	start, end, err := s.page(r, len(ids))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result := models.NetworkResult{Content: []*models.Network{}, TotalElements: int64(len(ids))}
+	for _, id := range ids[start:end] {
+		copied := *s.networks[id]
+		result.Content = append(result.Content, &copied)
+	}
+	result.NumberOfElements = int64(len(result.Content))
+	writeJSON(w, http.StatusOK, result)
+}
+
+// page returns the bounds of the page of n elements asked for by the $skip
+// and $top parameters of r
+func (s *Server) page(r *http.Request, n int) (int, int, error) {
+	limit := s.opts.PageSize
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	skip, top := 0, limit
+	query := r.URL.Query()
+	for name, value := range map[string]*int{"$skip": &skip, "$top": &top} {
+		if query.Get(name) == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(query.Get(name))
+		if err != nil || parsed < 0 {
+			return 0, 0, fmt.Errorf("invalid %s %q", name, query.Get(name))
+		}
+		*value = parsed
+	}
+	if top > limit {
+		top = limit
+	}
+
+	start, end := skip, skip+top
+	if start > n {
+		start = n
+	}
+	if end > n {
+		end = n
+	}
+	return start, end, nil
+}
+
+func (s *Server) getNetworkInterface(w http.ResponseWriter, machineID, id string) {
+	machine, ok := s.machines[machineID]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("machine %s not found", machineID))
+		return
+	}
+	nic, ok := s.nics[id]
+	if !ok || !containsHref(machine.Links["network-interfaces"].Hrefs, id) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("network interface %s not found", id))
+		return
+	}
+	writeJSON(w, http.StatusOK, nic)
+}
+
+// containsHref reports whether one of hrefs ends in id
+func containsHref(hrefs []string, id string) bool {
+	for _, href := range hrefs {
+		if strings.HasSuffix(href, "/"+id) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) getRequestTracker(w http.ResponseWriter, id string) {
+	request, ok := s.requests[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("request %s not found", id))
+		return
+	}
+	writeJSON(w, http.StatusOK, request.tracker)
+}
+
+// submit starts an asynchronous request that runs complete once it
+// finishes, and returns its tracker
+func (s *Server) submit(name string, complete func(tracker *models.RequestTracker)) *models.RequestTracker {
+	id := s.newID("request")
+	request := &trackedRequest{
+		tracker: &models.RequestTracker{
+			ID:       &id,
+			Name:     name,
+			Progress: int32Ptr(0),
+			SelfLink: stringPtr(defaultTrackerPrefix + id),
+			Status:   stringPtr(models.RequestTrackerStatusINPROGRESS),
+		},
+		submitted: s.now(),
+		complete:  complete,
+	}
+	if len(s.failRequests) > 0 {
+		request.failure = s.failRequests[0]
+		s.failRequests = s.failRequests[1:]
+	}
+	s.requests[id] = request
+
+	copied := *request.tracker
+	return &copied
+}
+
+// advance moves the requests in progress on, finishing the ones that are due
+func (s *Server) advance() {
+	now := s.now()
+	for _, request := range s.requests {
+		if *request.tracker.Status != models.RequestTrackerStatusINPROGRESS {
+			continue
+		}
+		elapsed := now.Sub(request.submitted)
+		if s.held || elapsed < s.opts.RequestDuration {
+			if s.opts.RequestDuration > 0 {
+				progress := int32(elapsed * 100 / s.opts.RequestDuration)
+				if progress > 99 {
+					progress = 99
+				}
+				request.tracker.Progress = int32Ptr(progress)
+			}
+			continue
+		}
+
+		request.tracker.Progress = int32Ptr(100)
+		if request.failure != "" {
+			request.tracker.Status = stringPtr(models.RequestTrackerStatusFAILED)
+			request.tracker.Message = request.failure
+			continue
+		}
+		request.complete(request.tracker)
+		request.tracker.Status = stringPtr(models.RequestTrackerStatusFINISHED)
+	}
+}
+
+func (s *Server) newID(prefix string) string {
+	s.nextID++
+	return fmt.Sprintf("%s-%d", prefix, s.nextID)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, models.Error{Message: message, StatusCode: int32(status)})
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func int32Ptr(i int32) *int32 {
+	return &i
+}
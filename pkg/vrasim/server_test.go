@@ -0,0 +1,370 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vrasim
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/go-openapi/runtime"
+	"github.com/go-openapi/strfmt"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sammcgeown/vra/pkg/vra"
+	vraclient "github.com/vmware/vra-sdk-go/pkg/client"
+	"github.com/vmware/vra-sdk-go/pkg/client/compute"
+	"github.com/vmware/vra-sdk-go/pkg/client/disk"
+	"github.com/vmware/vra-sdk-go/pkg/client/network"
+	"github.com/vmware/vra-sdk-go/pkg/client/request"
+	"github.com/vmware/vra-sdk-go/pkg/models"
+)
+
+var _ = Describe("Server", func() {
+	var (
+		server *Server
+		api    *vraclient.MulticloudIaaS
+	)
+
+	BeforeEach(func() {
+		server = NewServer(Options{RefreshToken: "refresh"})
+		var err error
+		api, err = vra.NewClient(vra.Config{URL: server.URL, RefreshToken: "refresh"})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	tag := func(key, value string) *models.Tag {
+		return &models.Tag{Key: &key, Value: &value}
+	}
+
+	createMachine := func(name string, tags ...*models.Tag) *models.RequestTracker {
+		project, flavor, image := "project", "small", "ubuntu"
+		created, err := api.Compute.CreateMachine(compute.NewCreateMachineParams().WithBody(&models.MachineSpecification{
+			Name:      &name,
+			ProjectID: &project,
+			Flavor:    &flavor,
+			Image:     &image,
+			Tags:      tags,
+		}))
+		Expect(err).NotTo(HaveOccurred())
+		return created.Payload
+	}
+
+	trackerStatus := func(id string) string {
+		tracker, err := api.Request.GetRequestTracker(request.NewGetRequestTrackerParams().WithID(id))
+		Expect(err).NotTo(HaveOccurred())
+		return *tracker.Payload.Status
+	}
+
+	findMachines := func(filter string) []*models.Machine {
+		machines, err := api.Compute.GetMachines(compute.NewGetMachinesParams().WithDollarFilter(&filter))
+		Expect(err).NotTo(HaveOccurred())
+		return machines.Payload.Content
+	}
+
+	It("rejects an unknown refresh token", func() {
+		_, err := vra.NewClient(vra.Config{URL: server.URL, RefreshToken: "wrong"})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("provisions machines asynchronously", func() {
+		server.Hold()
+		tracker := createMachine("web", tag("k8s_name", "web"))
+		Expect(trackerStatus(*tracker.ID)).To(Equal(models.RequestTrackerStatusINPROGRESS))
+		Expect(server.Machines()).To(BeEmpty())
+
+		server.Release()
+		Expect(trackerStatus(*tracker.ID)).To(Equal(models.RequestTrackerStatusFINISHED))
+		Expect(server.Machines()).To(HaveLen(1))
+	})
+
+	It("reports progress until the request duration has passed", func() {
+		now := time.Unix(1600000000, 0)
+		server.now = func() time.Time { return now }
+		server.opts.RequestDuration = time.Minute
+
+		tracker := createMachine("web")
+		now = now.Add(30 * time.Second)
+		payload, err := api.Request.GetRequestTracker(request.NewGetRequestTrackerParams().WithID(*tracker.ID))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*payload.Payload.Status).To(Equal(models.RequestTrackerStatusINPROGRESS))
+		Expect(*payload.Payload.Progress).To(BeEquivalentTo(50))
+
+		now = now.Add(30 * time.Second)
+		Expect(trackerStatus(*tracker.ID)).To(Equal(models.RequestTrackerStatusFINISHED))
+	})
+
+	It("filters machines on tag pairs", func() {
+		server.AddMachine(&models.Machine{Name: "a", Tags: []*models.Tag{tag("k8s_name", "web"), tag("k8s_namespace", "default")}})
+		server.AddMachine(&models.Machine{Name: "b", Tags: []*models.Tag{tag("k8s_name", "web"), tag("k8s_namespace", "other")}})
+		server.AddMachine(&models.Machine{Name: "c", Tags: []*models.Tag{tag("k8s_name", "db's")}})
+
+		Expect(findMachines("")).To(HaveLen(3))
+		Expect(findMachines("tags.item.key eq 'k8s_name' and tags.item.value eq 'web'")).To(HaveLen(2))
+		Expect(findMachines("tags.item.key eq 'k8s_name' and tags.item.value eq 'web' and " +
+			"tags.item.key eq 'k8s_namespace' and tags.item.value eq 'other'")).To(HaveLen(1))
+		Expect(findMachines("tags.item.key eq 'k8s_name' and tags.item.value eq 'db''s'")).To(HaveLen(1))
+
+		filter := "name eq 'a'"
+		_, err := api.Compute.GetMachines(compute.NewGetMachinesParams().WithDollarFilter(&filter))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("lists machines in pages", func() {
+		server.opts.PageSize = 2
+		for _, name := range []string{"a", "b", "c"} {
+			server.AddMachine(&models.Machine{Name: name, Tags: []*models.Tag{tag("k8s_name", "web")}})
+		}
+		server.AddMachine(&models.Machine{Name: "d", Tags: []*models.Tag{tag("k8s_name", "db")}})
+
+		filter := "tags.item.key eq 'k8s_name' and tags.item.value eq 'web'"
+		var names []string
+		for skip := int64(0); skip < 3; skip += 2 {
+			top := int64(10)
+			machines, err := api.Compute.GetMachines(compute.NewGetMachinesParams().
+				WithDollarFilter(&filter).WithDollarSkip(&skip).WithDollarTop(&top))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(machines.Payload.TotalElements).To(BeEquivalentTo(3))
+			for _, machine := range machines.Payload.Content {
+				names = append(names, machine.Name)
+			}
+		}
+		Expect(names).To(ConsistOf("a", "b", "c"))
+	})
+
+	It("deletes machines", func() {
+		id := server.AddMachine(&models.Machine{Name: "web"})
+		deleted, err := api.Compute.DeleteMachine(compute.NewDeleteMachineParams().WithID(id))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(trackerStatus(*deleted.Payload.ID)).To(Equal(models.RequestTrackerStatusFINISHED))
+		_, found := server.Machine(id)
+		Expect(found).To(BeFalse())
+
+		_, err = api.Compute.DeleteMachine(compute.NewDeleteMachineParams().WithID(id))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("changes the power state of machines", func() {
+		id := server.AddMachine(&models.Machine{Name: "web"})
+		suspended, err := api.Compute.SuspendMachine(compute.NewSuspendMachineParams().WithID(id))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(trackerStatus(*suspended.Payload.ID)).To(Equal(models.RequestTrackerStatusFINISHED))
+		machine, _ := server.Machine(id)
+		Expect(*machine.PowerState).To(Equal(models.MachinePowerStateSUSPEND))
+
+		shutdown, err := api.Compute.ShutdownMachine(compute.NewShutdownMachineParams().WithID(id))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(trackerStatus(*shutdown.Payload.ID)).To(Equal(models.RequestTrackerStatusFINISHED))
+		machine, _ = server.Machine(id)
+		Expect(*machine.PowerState).To(Equal(models.MachinePowerStateOFF))
+
+		_, err = api.Compute.PowerOnMachine(compute.NewPowerOnMachineParams().WithID("missing"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("resizes machines", func() {
+		created := createMachine("web")
+		Expect(trackerStatus(*created.ID)).To(Equal(models.RequestTrackerStatusFINISHED))
+		machine := server.Machines()[0]
+		Expect(machine.CustomProperties).To(HaveKeyWithValue("flavor", "small"))
+
+		flavor := "large"
+		resized, err := api.Compute.ResizeMachine(compute.NewResizeMachineParams().WithID(*machine.ID).WithName(&flavor))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(trackerStatus(*resized.Payload.ID)).To(Equal(models.RequestTrackerStatusFINISHED))
+		machine, _ = server.Machine(*machine.ID)
+		Expect(machine.CustomProperties).To(HaveKeyWithValue("flavor", "large"))
+	})
+
+	It("updates the tags of machines", func() {
+		created := createMachine("web")
+		Expect(trackerStatus(*created.ID)).To(Equal(models.RequestTrackerStatusFINISHED))
+		machine := server.Machines()[0]
+
+		updated, err := api.Compute.UpdateMachine(compute.NewUpdateMachineParams().WithID(*machine.ID).WithBody(&models.UpdateMachineSpecification{
+			Tags: []*models.Tag{tag("env", "prod")},
+		}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(updated.Payload.Tags).To(Equal([]*models.Tag{tag("env", "prod")}))
+		machine, _ = server.Machine(*machine.ID)
+		Expect(machine.Tags).To(Equal([]*models.Tag{tag("env", "prod")}))
+	})
+
+	It("creates, attaches, resizes and detaches disks", func() {
+		project, name, capacity := "project", "data", int32(10)
+		created, err := api.Disk.CreateBlockDevice(disk.NewCreateBlockDeviceParams().WithBody(&models.BlockDeviceSpecification{
+			Name: &name, ProjectID: &project, CapacityInGB: &capacity,
+		}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(trackerStatus(*created.Payload.ID)).To(Equal(models.RequestTrackerStatusFINISHED))
+		Expect(server.BlockDevices()).To(HaveLen(1))
+		diskID := *server.BlockDevices()[0].ID
+
+		flavor, image := "small", "ubuntu"
+		machine, err := api.Compute.CreateMachine(compute.NewCreateMachineParams().WithBody(&models.MachineSpecification{
+			Name: &name, ProjectID: &project, Flavor: &flavor, Image: &image,
+			Disks: []*models.DiskAttachmentSpecification{{BlockDeviceID: &diskID}},
+		}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(trackerStatus(*machine.Payload.ID)).To(Equal(models.RequestTrackerStatusFINISHED))
+		machineID := *server.Machines()[0].ID
+		disks, err := api.Disk.GetMachineDisks(disk.NewGetMachineDisksParams().WithID(machineID))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(disks.Payload.Content).To(HaveLen(1))
+
+		resized, _, err := api.Disk.ResizeBlockDevice(disk.NewResizeBlockDeviceParams().WithID(diskID).WithCapacityInGB(20))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(trackerStatus(*resized.Payload.ID)).To(Equal(models.RequestTrackerStatusFINISHED))
+		Expect(*server.BlockDevices()[0].CapacityInGB).To(BeEquivalentTo(20))
+
+		_, _, err = api.Disk.DeleteBlockDevice(disk.NewDeleteBlockDeviceParams().WithID(diskID))
+		Expect(err).To(HaveOccurred())
+
+		detached, err := api.Disk.DeleteMachineDisk(disk.NewDeleteMachineDiskParams().WithID(machineID).WithId1(diskID))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(trackerStatus(*detached.Payload.ID)).To(Equal(models.RequestTrackerStatusFINISHED))
+		disks, err = api.Disk.GetMachineDisks(disk.NewGetMachineDisksParams().WithID(machineID))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(disks.Payload.Content).To(BeEmpty())
+		Expect(*server.BlockDevices()[0].Status).To(Equal(models.BlockDeviceStatusAVAILABLE))
+	})
+
+	It("creates machines from an image reference", func() {
+		project, flavor, image, imageRef, name := "project", "small", "ubuntu", "ami-f6795a8c", "web"
+		_, err := api.Compute.CreateMachine(compute.NewCreateMachineParams().WithBody(&models.MachineSpecification{
+			Name: &name, ProjectID: &project, Flavor: &flavor, Image: &image, ImageRef: &imageRef,
+		}))
+		Expect(err).To(HaveOccurred())
+
+		created, err := api.Compute.CreateMachine(compute.NewCreateMachineParams().WithBody(&models.MachineSpecification{
+			Name: &name, ProjectID: &project, Flavor: &flavor, ImageRef: &imageRef,
+			Description: "web server", CustomProperties: map[string]string{"owner": "team-a"},
+		}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(trackerStatus(*created.Payload.ID)).To(Equal(models.RequestTrackerStatusFINISHED))
+		Expect(server.Machines()).To(HaveLen(1))
+		Expect(server.Machines()[0].Description).To(Equal("web server"))
+		Expect(server.Machines()[0].CustomProperties).To(HaveKeyWithValue("owner", "team-a"))
+	})
+
+	It("connects machines to networks", func() {
+		networkID := server.AddNetwork(&models.Network{Name: "app", ProjectID: "project", Tags: []*models.Tag{tag("tier", "app")}})
+		networks, err := api.Network.GetNetworks(network.NewGetNetworksParams())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(networks.Payload.Content).To(HaveLen(2))
+		networks, err = api.Network.GetNetworks(network.NewGetNetworksParams(), withQuery(map[string]string{"$filter": "projectId eq 'project'"}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(networks.Payload.Content).To(HaveLen(1))
+		Expect(networks.Payload.Content[0].Name).To(Equal("app"))
+
+		project, flavor, image, name := "project", "small", "ubuntu", "web"
+		created, err := api.Compute.CreateMachine(compute.NewCreateMachineParams().WithBody(&models.MachineSpecification{
+			Name: &name, ProjectID: &project, Flavor: &flavor, Image: &image,
+			Nics: []*models.NetworkInterfaceSpecification{{NetworkID: &networkID, Addresses: []string{"192.168.1.10"}}},
+		}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(trackerStatus(*created.Payload.ID)).To(Equal(models.RequestTrackerStatusFINISHED))
+
+		machine := server.Machines()[0]
+		Expect(machine.Address).To(Equal("192.168.1.10"))
+		Expect(machine.Links["network-interfaces"].Hrefs).To(HaveLen(1))
+		nicID := path.Base(machine.Links["network-interfaces"].Hrefs[0])
+		nic, err := api.Network.GetMachineNetworkInterface(network.NewGetMachineNetworkInterfaceParams().WithID(*machine.ID).WithId1(nicID))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(nic.Payload.Addresses).To(ConsistOf("192.168.1.10"))
+
+		missing := "missing"
+		_, err = api.Compute.CreateMachine(compute.NewCreateMachineParams().WithBody(&models.MachineSpecification{
+			Name: &name, ProjectID: &project, Flavor: &flavor, Image: &image,
+			Nics: []*models.NetworkInterfaceSpecification{{NetworkID: &missing}},
+		}))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("lists networks in pages", func() {
+		server.Close()
+		server = NewServer(Options{RefreshToken: "refresh", PageSize: 2})
+		var err error
+		api, err = vra.NewClient(vra.Config{URL: server.URL, RefreshToken: "refresh"})
+		Expect(err).NotTo(HaveOccurred())
+		for _, name := range []string{"a", "b", "c", "d"} {
+			server.AddNetwork(&models.Network{Name: name})
+		}
+
+		networks, err := api.Network.GetNetworks(network.NewGetNetworksParams())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(networks.Payload.Content).To(HaveLen(2))
+		Expect(networks.Payload.TotalElements).To(BeEquivalentTo(5))
+		networks, err = api.Network.GetNetworks(network.NewGetNetworksParams(), withQuery(map[string]string{"$top": "10"}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(networks.Payload.Content).To(HaveLen(2))
+
+		var names []string
+		for skip := 0; skip < 5; skip += 2 {
+			page := withQuery(map[string]string{"$skip": strconv.Itoa(skip)})
+			networks, err := api.Network.GetNetworks(network.NewGetNetworksParams(), page)
+			Expect(err).NotTo(HaveOccurred())
+			for _, network := range networks.Payload.Content {
+				names = append(names, network.Name)
+			}
+		}
+		Expect(names).To(ConsistOf("a", "b", "c", "d", "vrasim-network"))
+	})
+
+	It("fails calls and requests on demand", func() {
+		server.FailNext(http.MethodPost, "/iaas/api/machines", http.StatusBadRequest, "quota exceeded")
+		project, flavor, image, name := "project", "small", "ubuntu", "web"
+		_, err := api.Compute.CreateMachine(compute.NewCreateMachineParams().WithBody(&models.MachineSpecification{
+			Name: &name, ProjectID: &project, Flavor: &flavor, Image: &image,
+		}))
+		Expect(err).To(HaveOccurred())
+
+		server.FailNextRequest("no placement found")
+		tracker := createMachine("web")
+		payload, err := api.Request.GetRequestTracker(request.NewGetRequestTrackerParams().WithID(*tracker.ID))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*payload.Payload.Status).To(Equal(models.RequestTrackerStatusFAILED))
+		Expect(payload.Payload.Message).To(Equal("no placement found"))
+		Expect(server.Machines()).To(BeEmpty())
+	})
+
+	It("makes clients log in again once tokens expire", func() {
+		server.ExpireTokens()
+		Expect(findMachines("")).To(BeEmpty())
+	})
+})
+
+// withQuery adds params to the query of a networks call, the generated
+// parameters of which have no paging fields
+func withQuery(params map[string]string) network.ClientOption {
+	return func(op *runtime.ClientOperation) {
+		writer := op.Params
+		op.Params = runtime.ClientRequestWriterFunc(func(req runtime.ClientRequest, reg strfmt.Registry) error {
+			for name, value := range params {
+				if err := req.SetQueryParam(name, value); err != nil {
+					return err
+				}
+			}
+			return writer.WriteToRequest(req, reg)
+		})
+	}
+}